@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+)
+
+var (
+	// ErrUnauthenticated 请求没有携带凭证或凭证格式错误，对应 401
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrForbidden 凭证校验失败，对应 403
+	ErrForbidden = errors.New("forbidden")
+)
+
+const (
+	TimestampHeaderKey = "X-Edge-Auth-Timestamp"
+	NonceHeaderKey     = "X-Edge-Auth-Nonce"
+	SignatureHeaderKey = "X-Edge-Auth-Signature"
+)
+
+// Authenticator 在 expose 流程 websocket upgrade 之前校验设备凭证
+type Authenticator interface {
+	Authenticate(r *http.Request, deviceID, serviceID string) error
+}
+
+// Signer 由 exposer client 使用，为 expose 请求的 header 签名
+type Signer interface {
+	Sign(header http.Header, deviceID, serviceID string) error
+}
+
+// StatusCode 将 Authenticator 返回的错误转换为 http 状态码
+func StatusCode(err error) int {
+	if errors.Is(err, ErrUnauthenticated) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusForbidden
+}
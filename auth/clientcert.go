@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+)
+
+// ClientCertAuthenticator 使用 mTLS 客户端证书认证设备：证书需要已经通过 tls 层校验，
+// 且 CommonName 或 DNS SAN 之一与 X-Edge-Device-ID 一致，否则拒绝。
+// 请求没有携带客户端证书时交给 Fallback（例如 HMACAuthenticator），Fallback 为 nil 时拒绝。
+type ClientCertAuthenticator struct {
+	Fallback Authenticator
+}
+
+var _ Authenticator = &ClientCertAuthenticator{}
+
+func (a *ClientCertAuthenticator) Authenticate(r *http.Request, deviceID, serviceID string) error {
+	cert := VerifiedClientCert(r)
+	if cert == nil {
+		if a.Fallback != nil {
+			return a.Fallback.Authenticate(r, deviceID, serviceID)
+		}
+		return fmt.Errorf("%w: client certificate required", ErrUnauthenticated)
+	}
+	for _, id := range CertDeviceIDs(cert) {
+		if id == deviceID {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: device id %q does not match client certificate %q", ErrForbidden, deviceID, cert.Subject.CommonName)
+}
+
+// VerifiedClientCert 返回请求携带的、已经通过 tls 层校验的客户端证书，没有时返回 nil
+func VerifiedClientCert(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// CertDeviceIDs 证书可以代表的设备 ID：CommonName 和 DNS SAN
+func CertDeviceIDs(cert *x509.Certificate) []string {
+	var ids []string
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	return append(ids, cert.DNSNames...)
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultMaxClockSkew 签名时间戳与服务端时间允许的最大偏差
+const defaultMaxClockSkew = 5 * time.Minute
+
+// HMACAuthenticator 校验 HMACSigner 生成的签名。
+// 签名包含随机 nonce，时间窗口内同一设备的 nonce 只能使用一次，截获的请求头不能重放。
+// nonce 只记录在本节点内存中，多个 exposer server 之间不共享。
+type HMACAuthenticator struct {
+	Secrets      SecretStore
+	MaxClockSkew time.Duration
+
+	mu     sync.Mutex
+	nonces map[string]time.Time // <device-id> <nonce> => 过期时间
+}
+
+var _ Authenticator = &HMACAuthenticator{}
+
+func NewHMACAuthenticator(secrets SecretStore) *HMACAuthenticator {
+	return &HMACAuthenticator{Secrets: secrets, MaxClockSkew: defaultMaxClockSkew}
+}
+
+func (a *HMACAuthenticator) Authenticate(r *http.Request, deviceID, serviceID string) error {
+	timestamp := r.Header.Get(TimestampHeaderKey)
+	nonce := r.Header.Get(NonceHeaderKey)
+	signature := r.Header.Get(SignatureHeaderKey)
+	if timestamp == "" || nonce == "" || signature == "" {
+		return fmt.Errorf("%w: %s, %s or %s header not exist", ErrUnauthenticated, TimestampHeaderKey, NonceHeaderKey, SignatureHeaderKey)
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad %s header", ErrUnauthenticated, TimestampHeaderKey)
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: bad %s header", ErrUnauthenticated, SignatureHeaderKey)
+	}
+	if skew := time.Since(time.Unix(unix, 0)); skew > a.MaxClockSkew || skew < -a.MaxClockSkew {
+		return fmt.Errorf("%w: timestamp out of range", ErrForbidden)
+	}
+	secret, err := a.Secrets.DeviceSecret(deviceID)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(got, sign(secret, deviceID, serviceID, timestamp, nonce)) {
+		return fmt.Errorf("%w: signature mismatch", ErrForbidden)
+	}
+	// 签名校验通过后才记录 nonce，伪造的请求不会占用内存
+	if !a.useNonce(deviceID, nonce, time.Unix(unix, 0).Add(a.MaxClockSkew)) {
+		return fmt.Errorf("%w: nonce already used", ErrForbidden)
+	}
+	return nil
+}
+
+// useNonce 记录 nonce，直到 expireAt 之后时间戳校验会拒绝该请求。nonce 已经使用过时返回 false
+func (a *HMACAuthenticator) useNonce(deviceID, nonce string, expireAt time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	if a.nonces == nil {
+		a.nonces = map[string]time.Time{}
+	}
+	for key, exp := range a.nonces {
+		if exp.Before(now) {
+			delete(a.nonces, key)
+		}
+	}
+	key := deviceID + " " + nonce
+	if _, ok := a.nonces[key]; ok {
+		return false
+	}
+	a.nonces[key] = expireAt
+	return true
+}
+
+// HMACSigner 使用设备密钥为 expose 请求签名
+type HMACSigner struct {
+	Secret []byte
+}
+
+var _ Signer = &HMACSigner{}
+
+func (s *HMACSigner) Sign(header http.Header, deviceID, serviceID string) error {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	timestamp, nonce := strconv.FormatInt(time.Now().Unix(), 10), hex.EncodeToString(b)
+	header.Set(TimestampHeaderKey, timestamp)
+	header.Set(NonceHeaderKey, nonce)
+	header.Set(SignatureHeaderKey, hex.EncodeToString(sign(s.Secret, deviceID, serviceID, timestamp, nonce)))
+	return nil
+}
+
+// sign 签名内容: "expose\n<device-id>\n<service-id>\n<timestamp>\n<nonce>"
+func sign(secret []byte, deviceID, serviceID, timestamp, nonce string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("expose\n" + deviceID + "\n" + serviceID + "\n" + timestamp + "\n" + nonce))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHMACAuthenticator(t *testing.T) {
+	secrets := &DerivedSecretStore{Master: []byte("master")}
+	signed := func(deviceID string) http.Header {
+		header := http.Header{}
+		signer := &HMACSigner{Secret: DeriveDeviceSecret(secrets.Master, deviceID)}
+		if err := signer.Sign(header, deviceID, ""); err != nil {
+			t.Fatal(err)
+		}
+		return header
+	}
+	// resign 使用新的时间戳重新计算签名，模拟设备时钟偏差
+	resign := func(header http.Header, deviceID string, at time.Time) {
+		timestamp := strconv.FormatInt(at.Unix(), 10)
+		header.Set(TimestampHeaderKey, timestamp)
+		header.Set(SignatureHeaderKey, hex.EncodeToString(sign(DeriveDeviceSecret(secrets.Master, deviceID), deviceID, "", timestamp, header.Get(NonceHeaderKey))))
+	}
+	for _, tc := range []struct {
+		name     string
+		deviceID string // 请求中的设备 ID
+		header   func() http.Header
+		want     error
+	}{
+		{"Valid", "DEVICE-0000", func() http.Header { return signed("DEVICE-0000") }, nil},
+		{"SmallSkew", "DEVICE-0000", func() http.Header {
+			h := signed("DEVICE-0000")
+			resign(h, "DEVICE-0000", time.Now().Add(-time.Minute))
+			return h
+		}, nil},
+		{"MissingHeader", "DEVICE-0000", func() http.Header { return http.Header{} }, ErrUnauthenticated},
+		{"MissingNonce", "DEVICE-0000", func() http.Header {
+			h := signed("DEVICE-0000")
+			h.Del(NonceHeaderKey)
+			return h
+		}, ErrUnauthenticated},
+		{"BadTimestamp", "DEVICE-0000", func() http.Header {
+			h := signed("DEVICE-0000")
+			h.Set(TimestampHeaderKey, "yesterday")
+			return h
+		}, ErrUnauthenticated},
+		{"BadSignatureEncoding", "DEVICE-0000", func() http.Header {
+			h := signed("DEVICE-0000")
+			h.Set(SignatureHeaderKey, "not-hex")
+			return h
+		}, ErrUnauthenticated},
+		{"TamperedSignature", "DEVICE-0000", func() http.Header {
+			h := signed("DEVICE-0000")
+			sig := h.Get(SignatureHeaderKey)
+			if sig[0] == '0' {
+				h.Set(SignatureHeaderKey, "1"+sig[1:])
+			} else {
+				h.Set(SignatureHeaderKey, "0"+sig[1:])
+			}
+			return h
+		}, ErrForbidden},
+		{"TamperedTimestamp", "DEVICE-0000", func() http.Header {
+			h := signed("DEVICE-0000")
+			unix, _ := strconv.ParseInt(h.Get(TimestampHeaderKey), 10, 64)
+			h.Set(TimestampHeaderKey, strconv.FormatInt(unix+1, 10))
+			return h
+		}, ErrForbidden},
+		{"TamperedNonce", "DEVICE-0000", func() http.Header {
+			h := signed("DEVICE-0000")
+			h.Set(NonceHeaderKey, "00000000000000000000000000000000")
+			return h
+		}, ErrForbidden},
+		{"Skewed", "DEVICE-0000", func() http.Header {
+			h := signed("DEVICE-0000")
+			resign(h, "DEVICE-0000", time.Now().Add(-2*defaultMaxClockSkew))
+			return h
+		}, ErrForbidden},
+		{"SkewedFuture", "DEVICE-0000", func() http.Header {
+			h := signed("DEVICE-0000")
+			resign(h, "DEVICE-0000", time.Now().Add(2*defaultMaxClockSkew))
+			return h
+		}, ErrForbidden},
+		{"WrongDevice", "DEVICE-0001", func() http.Header { return signed("DEVICE-0000") }, ErrForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a := NewHMACAuthenticator(secrets)
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header = tc.header()
+			err := a.Authenticate(r, tc.deviceID, "")
+			if tc.want == nil && err != nil || tc.want != nil && !errors.Is(err, tc.want) {
+				t.Fatalf("Authenticate error = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestHMACAuthenticatorReplay(t *testing.T) {
+	secrets := &DerivedSecretStore{Master: []byte("master")}
+	a := NewHMACAuthenticator(secrets)
+	secret := DeriveDeviceSecret(secrets.Master, "DEVICE-0000")
+	r := newSignedRequest(t, secret, "DEVICE-0000")
+	if err := a.Authenticate(r, "DEVICE-0000", ""); err != nil {
+		t.Fatalf("first Authenticate: %v", err)
+	}
+	if err := a.Authenticate(r, "DEVICE-0000", ""); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("replayed Authenticate error = %v, want ErrForbidden", err)
+	}
+	// 新的签名使用新的 nonce
+	if err := a.Authenticate(newSignedRequest(t, secret, "DEVICE-0000"), "DEVICE-0000", ""); err != nil {
+		t.Fatalf("Authenticate with new nonce: %v", err)
+	}
+}
+
+func newSignedRequest(t *testing.T, secret []byte, deviceID string) *http.Request {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := (&HMACSigner{Secret: secret}).Sign(r.Header, deviceID, ""); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrNoCredential 请求中没有该 IdentityResolver 关心的凭证，ChainResolver 会继续尝试下一个
+var ErrNoCredential = fmt.Errorf("%w: no credential", ErrUnauthenticated)
+
+const (
+	APIKeyHeaderKey             = "X-Edge-API-Key"
+	ProxyAuthorizationHeaderKey = "Proxy-Authorization"
+)
+
+type IdentityMethod string
+
+const (
+	IdentityMethodBearer     IdentityMethod = "bearer"
+	IdentityMethodClientCert IdentityMethod = "mtls"
+	IdentityMethodAPIKey     IdentityMethod = "apikey"
+	IdentityMethodPassword   IdentityMethod = "password"
+)
+
+// Identity access 流程调用方的身份
+type Identity struct {
+	Name   string
+	Method IdentityMethod
+}
+
+func (i Identity) String() string {
+	if i.Name == "" {
+		return "anonymous"
+	}
+	return string(i.Method) + ":" + i.Name
+}
+
+// ParseIdentity 是 Identity.String 的逆操作
+func ParseIdentity(s string) Identity {
+	method, name, ok := strings.Cut(s, ":")
+	if !ok {
+		return Identity{}
+	}
+	return Identity{Name: name, Method: IdentityMethod(method)}
+}
+
+// IdentityResolver 从 access 请求中解析调用方身份
+type IdentityResolver interface {
+	Resolve(r *http.Request) (Identity, error)
+}
+
+// BearerTokenResolver 通过 `Authorization: Bearer <token>` 解析身份
+type BearerTokenResolver struct {
+	Tokens map[string]string // token => identity
+}
+
+var _ IdentityResolver = &BearerTokenResolver{}
+
+// LoadBearerTokensFile 加载每行为 `<token> <identity>` 的文件
+func LoadBearerTokensFile(path string) (*BearerTokenResolver, error) {
+	tokens, err := loadPairsFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &BearerTokenResolver{Tokens: tokens}, nil
+}
+
+func (b *BearerTokenResolver) Resolve(r *http.Request) (Identity, error) {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return Identity{}, ErrNoCredential
+	}
+	return b.lookup(strings.TrimPrefix(authorization, "Bearer "))
+}
+
+func (b *BearerTokenResolver) lookup(token string) (Identity, error) {
+	name, ok := b.Tokens[token]
+	if !ok {
+		return Identity{}, fmt.Errorf("%w: invalid bearer token", ErrUnauthenticated)
+	}
+	return Identity{Name: name, Method: IdentityMethodBearer}, nil
+}
+
+// APIKeyResolver 通过 X-Edge-API-Key header 解析身份
+type APIKeyResolver struct {
+	Keys map[string]string // api key => identity
+}
+
+var _ IdentityResolver = &APIKeyResolver{}
+
+// LoadAPIKeysFile 加载每行为 `<api-key> <identity>` 的文件
+func LoadAPIKeysFile(path string) (*APIKeyResolver, error) {
+	keys, err := loadPairsFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &APIKeyResolver{Keys: keys}, nil
+}
+
+func (a *APIKeyResolver) Resolve(r *http.Request) (Identity, error) {
+	key := r.Header.Get(APIKeyHeaderKey)
+	if key == "" {
+		return Identity{}, ErrNoCredential
+	}
+	name, ok := a.Keys[key]
+	if !ok {
+		return Identity{}, fmt.Errorf("%w: invalid api key", ErrUnauthenticated)
+	}
+	return Identity{Name: name, Method: IdentityMethodAPIKey}, nil
+}
+
+// PasswordStore 校验用户名密码，用户名即调用方身份。用于无法携带 bearer token 的协议，例如 SOCKS5 的用户名密码认证
+type PasswordStore struct {
+	Passwords map[string]string // username => password
+}
+
+// LoadPasswordsFile 加载每行为 `<username> <password>` 的文件
+func LoadPasswordsFile(path string) (*PasswordStore, error) {
+	passwords, err := loadPairsFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &PasswordStore{Passwords: passwords}, nil
+}
+
+func (s *PasswordStore) Verify(username, password string) (Identity, error) {
+	want, ok := s.Passwords[username]
+	if !ok || subtle.ConstantTimeCompare([]byte(want), []byte(password)) != 1 {
+		return Identity{}, fmt.Errorf("%w: invalid username or password", ErrUnauthenticated)
+	}
+	return Identity{Name: username, Method: IdentityMethodPassword}, nil
+}
+
+// ProxyAuthorizationResolver 通过 `Proxy-Authorization` 解析 http 代理（CONNECT）调用方的身份，
+// 支持 `Basic <base64(username:password)>` 和 `Bearer <token>`
+type ProxyAuthorizationResolver struct {
+	// Passwords 为 nil 时不支持 Basic，Tokens 为 nil 时不支持 Bearer
+	Passwords *PasswordStore
+	Tokens    *BearerTokenResolver
+}
+
+var _ IdentityResolver = &ProxyAuthorizationResolver{}
+
+func (p *ProxyAuthorizationResolver) Resolve(r *http.Request) (Identity, error) {
+	authorization := r.Header.Get(ProxyAuthorizationHeaderKey)
+	scheme, credential, _ := strings.Cut(authorization, " ")
+	switch {
+	case authorization == "":
+		return Identity{}, ErrNoCredential
+	case strings.EqualFold(scheme, "Basic") && p.Passwords != nil:
+		decoded, err := base64.StdEncoding.DecodeString(credential)
+		if err != nil {
+			return Identity{}, fmt.Errorf("%w: invalid basic credential", ErrUnauthenticated)
+		}
+		username, password, ok := strings.Cut(string(decoded), ":")
+		if !ok {
+			return Identity{}, fmt.Errorf("%w: invalid basic credential", ErrUnauthenticated)
+		}
+		return p.Passwords.Verify(username, password)
+	case strings.EqualFold(scheme, "Bearer") && p.Tokens != nil:
+		return p.Tokens.lookup(credential)
+	default:
+		return Identity{}, fmt.Errorf("%w: unsupported proxy authorization scheme %q", ErrUnauthenticated, scheme)
+	}
+}
+
+// ClientCertResolver 使用 mTLS 客户端证书的 CommonName 作为身份，证书需要已经通过 tls 层校验
+type ClientCertResolver struct{}
+
+var _ IdentityResolver = ClientCertResolver{}
+
+func (ClientCertResolver) Resolve(r *http.Request) (Identity, error) {
+	cert := VerifiedClientCert(r)
+	if cert == nil {
+		return Identity{}, ErrNoCredential
+	}
+	cn := cert.Subject.CommonName
+	if cn == "" {
+		return Identity{}, fmt.Errorf("%w: client certificate without common name", ErrUnauthenticated)
+	}
+	return Identity{Name: cn, Method: IdentityMethodClientCert}, nil
+}
+
+// ChainResolver 依次尝试多个 IdentityResolver，返回第一个携带了凭证的结果
+type ChainResolver []IdentityResolver
+
+var _ IdentityResolver = ChainResolver{}
+
+func (c ChainResolver) Resolve(r *http.Request) (Identity, error) {
+	for _, resolver := range c {
+		identity, err := resolver.Resolve(r)
+		if errors.Is(err, ErrNoCredential) {
+			continue
+		}
+		return identity, err
+	}
+	return Identity{}, ErrNoCredential
+}
+
+// StripCredential 删除请求中用于认证的凭证 header，避免透传到边缘服务
+func StripCredential(r *http.Request, identity Identity) {
+	switch identity.Method {
+	case IdentityMethodBearer:
+		r.Header.Del("Authorization")
+	case IdentityMethodAPIKey:
+		r.Header.Del(APIKeyHeaderKey)
+	}
+}
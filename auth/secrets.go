@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SecretStore 查询设备的密钥
+type SecretStore interface {
+	DeviceSecret(deviceID string) ([]byte, error)
+}
+
+// DerivedSecretStore 设备密钥由主密钥派生: HMAC-SHA256(master, device-id)。
+// 设备出厂时烧录派生后的密钥，服务端只需要保存主密钥。
+type DerivedSecretStore struct {
+	Master []byte
+}
+
+var _ SecretStore = &DerivedSecretStore{}
+
+func (s *DerivedSecretStore) DeviceSecret(deviceID string) ([]byte, error) {
+	return DeriveDeviceSecret(s.Master, deviceID), nil
+}
+
+// DeriveDeviceSecret 根据主密钥计算设备密钥
+func DeriveDeviceSecret(master []byte, deviceID string) []byte {
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte(deviceID))
+	return mac.Sum(nil)
+}
+
+// FileSecretStore 从静态文件加载的设备密钥。
+// 文件每行格式为 `<device-id> <secret>`，空行和 # 开头的行会被忽略。
+type FileSecretStore struct {
+	secrets map[string][]byte
+}
+
+var _ SecretStore = &FileSecretStore{}
+
+func LoadSecretsFile(path string) (*FileSecretStore, error) {
+	pairs, err := loadPairsFile(path)
+	if err != nil {
+		return nil, err
+	}
+	secrets := make(map[string][]byte, len(pairs))
+	for deviceID, secret := range pairs {
+		secrets[deviceID] = []byte(secret)
+	}
+	return &FileSecretStore{secrets: secrets}, nil
+}
+
+func (s *FileSecretStore) DeviceSecret(deviceID string) ([]byte, error) {
+	secret, ok := s.secrets[deviceID]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown device %s", ErrForbidden, deviceID)
+	}
+	return secret, nil
+}
+
+// loadPairsFile 加载每行为 `<key> <value>` 的文件，空行和 # 开头的行会被忽略
+func loadPairsFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	pairs := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want `<key> <value>`", path, lineNo)
+		}
+		pairs[fields[0]] = fields[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return pairs, nil
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSecretsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.txt")
+	content := "# device secrets\n\nDEVICE-0000 secret-0\n  DEVICE-0001   secret-1  \n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := LoadSecretsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deviceID, want := range map[string]string{"DEVICE-0000": "secret-0", "DEVICE-0001": "secret-1"} {
+		got, err := store.DeviceSecret(deviceID)
+		if err != nil || !bytes.Equal(got, []byte(want)) {
+			t.Errorf("DeviceSecret(%q) = %q, %v; want %q", deviceID, got, err, want)
+		}
+	}
+	if _, err := store.DeviceSecret("DEVICE-0002"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("DeviceSecret of unknown device error = %v, want ErrForbidden", err)
+	}
+
+	// 使用文件中的密钥签名，其他设备的密钥不能通过校验
+	a := NewHMACAuthenticator(store)
+	for _, tc := range []struct {
+		secret string
+		ok     bool
+	}{{"secret-0", true}, {"secret-1", false}} {
+		r := newSignedRequest(t, []byte(tc.secret), "DEVICE-0000")
+		if err := a.Authenticate(r, "DEVICE-0000", ""); (err == nil) != tc.ok {
+			t.Errorf("Authenticate with %s error = %v, want ok %v", tc.secret, err, tc.ok)
+		}
+	}
+}
+
+func TestLoadSecretsFileMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.txt")
+	if err := os.WriteFile(path, []byte("DEVICE-0000\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSecretsFile(path); err == nil {
+		t.Fatal("LoadSecretsFile with malformed line want error")
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/demo"
+	"github.com/rectcircle/expose-edge-service-demo/exposer"
+)
+
+// 在边缘设备上通过 exposer client 的控制接口管理暴露的服务
+
+// controlSocketEnvKey 未通过 -socket 指定时，从该环境变量读取控制接口的 socket 路径
+const controlSocketEnvKey = "EDGE_CONTROL_SOCKET"
+
+func init() {
+	commands["services"] = command{help: "列出已暴露的服务及状态", run: runServices}
+	commands["expose"] = command{args: "<service-id> <target>", help: "暴露设备上的服务，target 可以是端口、host:port、unix:///path 或 pipe://name", run: runExpose}
+	commands["unexpose"] = command{args: "<service-id>", help: "取消暴露服务", run: runUnExpose}
+	commands["stats"] = command{help: "查看到 exposer server 的会话统计", run: runStats}
+}
+
+// controlFlags 解析子命令的参数，返回控制接口客户端和剩余的位置参数
+func controlFlags(name string, args []string, nArgs int) (*exposer.ControlClient, []string, error) {
+	fs := flag.NewFlagSet("edgectl "+name, flag.ContinueOnError)
+	socket := os.Getenv(controlSocketEnvKey)
+	if socket == "" {
+		socket = demo.ExposerClientControlSocket
+	}
+	fs.StringVar(&socket, "socket", socket, "exposer client 控制接口的 unix socket 路径 (环境变量 "+controlSocketEnvKey+")")
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	if fs.NArg() != nArgs {
+		return nil, nil, fmt.Errorf("want %d arguments, got %d", nArgs, fs.NArg())
+	}
+	return exposer.NewControlClient(socket), fs.Args(), nil
+}
+
+func runServices(args []string) error {
+	c, _, err := controlFlags("services", args, 0)
+	if err != nil {
+		return err
+	}
+	statuses, err := c.Services()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tTARGET\tSTATE\tSINCE\tATTEMPTS\tLAST ERROR")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", s.ServiceID, s.Target, s.State, s.Since.Format(time.RFC3339), s.Attempts, s.LastError)
+	}
+	return w.Flush()
+}
+
+func runExpose(args []string) error {
+	c, rest, err := controlFlags("expose", args, 2)
+	if err != nil {
+		return err
+	}
+	if err := c.Expose(rest[0], rest[1]); err != nil {
+		return err
+	}
+	fmt.Printf("service %s exposed, target %s\n", rest[0], rest[1])
+	return nil
+}
+
+func runUnExpose(args []string) error {
+	c, rest, err := controlFlags("unexpose", args, 1)
+	if err != nil {
+		return err
+	}
+	if err := c.UnExpose(rest[0]); err != nil {
+		return err
+	}
+	fmt.Printf("service %s unexposed\n", rest[0])
+	return nil
+}
+
+func runStats(args []string) error {
+	c, _, err := controlFlags("stats", args, 0)
+	if err != nil {
+		return err
+	}
+	s, err := c.Stats()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "device\t%s\n", s.DeviceID)
+	fmt.Fprintf(w, "server\t%s\n", s.ServerURL)
+	fmt.Fprintf(w, "state\t%s (since %s)\n", s.State, s.Since.Format(time.RFC3339))
+	fmt.Fprintf(w, "attempts\t%d\n", s.Attempts)
+	if s.LastError != "" {
+		fmt.Fprintf(w, "last error\t%s\n", s.LastError)
+	}
+	fmt.Fprintf(w, "services\t%d\n", s.Services)
+	fmt.Fprintf(w, "streams\t%d active (%d udp flows), %d total\n", s.ActiveStreams, s.ActiveUDP, s.TotalStreams)
+	fmt.Fprintf(w, "bytes\t%d to edge, %d from edge\n", s.BytesToEdge, s.BytesFromEdge)
+	if s.RTTMillis > 0 {
+		fmt.Fprintf(w, "rtt\t%.3fms\n", s.RTTMillis)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/demo"
+	"github.com/rectcircle/expose-edge-service-demo/exposer"
+	"github.com/rectcircle/expose-edge-service-demo/helper"
+	"github.com/rectcircle/expose-edge-service-demo/protoconv"
+	"github.com/rectcircle/expose-edge-service-demo/tlsconfig"
+)
+
+// 在开发机上通过 exposer server 的 access 流程访问边缘设备的服务，不需要部署 tcp 协议转换服务
+
+const (
+	// serverURLEnvKey、tokenEnvKey 未通过 -server、-token 指定时，从环境变量读取
+	serverURLEnvKey = "EDGE_SERVER_URL"
+	tokenEnvKey     = "EDGE_TOKEN"
+)
+
+// portForwardRetryPolicy 打开 access 连接失败时的重试间隔（设备正在重连、exposer server 正在下线等）
+var portForwardRetryPolicy = exposer.ReconnectPolicy{
+	InitialInterval: 200 * time.Millisecond,
+	MaxInterval:     2 * time.Second,
+	Multiplier:      2,
+}
+
+func init() {
+	commands["port-forward"] = command{args: "<device-id>/<service-id> [local-address:]port", help: "在本地端口监听，将每个连接通过 exposer server 转发到边缘设备的服务", run: runPortForward}
+}
+
+func runPortForward(args []string) error {
+	fs := flag.NewFlagSet("edgectl port-forward", flag.ContinueOnError)
+	serverURL := envOr(serverURLEnvKey, demo.ExposerServerURL)
+	token := envOr(tokenEnvKey, demo.DemoUserToken)
+	var tlsCfg tlsconfig.ClientConfig
+	fs.StringVar(&serverURL, "server", serverURL, "exposer server 地址，ws:// 或 wss:// (环境变量 "+serverURLEnvKey+")")
+	fs.StringVar(&token, "token", token, "访问 exposer server 的 bearer token (环境变量 "+tokenEnvKey+")")
+	fs.StringVar(&tlsCfg.CAFile, "tls-ca-file", "", "校验 exposer server 证书的 CA，默认使用系统 CA")
+	fs.StringVar(&tlsCfg.CertFile, "tls-cert-file", "", "mTLS 客户端证书")
+	fs.StringVar(&tlsCfg.KeyFile, "tls-key-file", "", "mTLS 客户端私钥")
+	fs.StringVar(&tlsCfg.ServerName, "tls-server-name", "", "校验 exposer server 证书使用的域名，默认使用地址中的 host")
+	retryTimeout := fs.Duration("retry-timeout", 10*time.Second, "打开 access 连接失败时重试的时间，0 表示不重试")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("want 2 arguments, got %d", fs.NArg())
+	}
+	edgeDeviceID, edgeServiceID, ok := strings.Cut(fs.Arg(0), "/")
+	if !ok || edgeDeviceID == "" || edgeServiceID == "" {
+		return fmt.Errorf("invalid target %q, want <device-id>/<service-id>", fs.Arg(0))
+	}
+	localAddr := fs.Arg(1)
+	if !strings.Contains(localAddr, ":") {
+		// 只指定端口时只监听本机
+		localAddr = "127.0.0.1:" + localAddr
+	}
+
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return fmt.Errorf("invalid server url %q: %w", serverURL, err)
+	}
+	d := &protoconv.AccessDialer{}
+	switch u.Scheme {
+	case "ws":
+		if !tlsCfg.IsZero() {
+			return errors.New("tls options require a wss:// server url")
+		}
+	case "wss":
+		if d.TLSConfig, err = tlsCfg.Load(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid server url %q, want ws:// or wss://", serverURL)
+	}
+	if token != "" {
+		d.Header = http.Header{"Authorization": {"Bearer " + token}}
+	}
+
+	listen, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Forwarding from %s -> %s/%s via %s\n", listen.Addr(), edgeDeviceID, edgeServiceID, serverURL)
+	// Ctrl+C 停止监听，已经建立的连接随进程退出
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		_ = listen.Close()
+	}()
+
+	pf := &portForwarder{dialer: d, addr: u.Host, deviceID: edgeDeviceID, serviceID: edgeServiceID, retryTimeout: *retryTimeout}
+	for {
+		conn, err := listen.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go pf.forward(conn)
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+type portForwarder struct {
+	dialer       *protoconv.AccessDialer
+	addr         string // exposer server 的 host:port
+	deviceID     string
+	serviceID    string
+	retryTimeout time.Duration
+
+	connID int64
+}
+
+// forward 打开 access 连接并转发，每个连接的结果输出一行
+func (pf *portForwarder) forward(conn net.Conn) {
+	defer conn.Close()
+	id := atomic.AddInt64(&pf.connID, 1)
+	remote := conn.RemoteAddr().String()
+	fmt.Printf("[%d] handling connection from %s\n", id, remote)
+	nextConn, attempts, err := pf.dial()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[%d] connection from %s: open access stream failed after %d attempts: %s\n", id, remote, attempts, err)
+		return
+	}
+	defer nextConn.Close()
+	if attempts > 1 {
+		fmt.Printf("[%d] access stream opened after %d attempts\n", id, attempts)
+	}
+	start := time.Now()
+	if err := helper.IORelay(nextConn, conn); err != nil && !errors.Is(err, net.ErrClosed) {
+		fmt.Fprintf(os.Stderr, "[%d] connection from %s: relay error after %s: %s\n", id, remote, time.Since(start).Round(time.Millisecond), err)
+		return
+	}
+	fmt.Printf("[%d] connection from %s closed after %s\n", id, remote, time.Since(start).Round(time.Millisecond))
+}
+
+// dial 打开 access 连接。设备正在重连、exposer server 正在下线等暂时性的错误会在 retryTimeout 内按退避重试，
+// 鉴权失败等不会因重试而改变的错误立即返回
+func (pf *portForwarder) dial() (net.Conn, int, error) {
+	deadline := time.Now().Add(pf.retryTimeout)
+	for attempt := 0; ; attempt++ {
+		conn, err := pf.dialer.Dial(pf.addr, pf.deviceID, pf.serviceID)
+		if err == nil {
+			return conn, attempt + 1, nil
+		}
+		backoff := portForwardRetryPolicy.Backoff(attempt)
+		if !retryable(err) || time.Now().Add(backoff).After(deadline) {
+			return nil, attempt + 1, err
+		}
+		time.Sleep(backoff)
+	}
+}
+
+func retryable(err error) bool {
+	var accessErr *protoconv.AccessError
+	if !errors.As(err, &accessErr) {
+		// 网络错误，exposer server 可能正在重启
+		return true
+	}
+	switch accessErr.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusInternalServerError:
+		return true
+	}
+	return false
+}
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"github.com/rectcircle/expose-edge-service-demo/config"
 	"github.com/rectcircle/expose-edge-service-demo/demo"
 	"github.com/rectcircle/expose-edge-service-demo/edgeservice"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
 )
 
 func main() {
-	edgeservice.Run(demo.DemoEdgeService1ID, demo.DemoEdgeService1Port)
+	cfg := config.DefaultEdgeServiceConfig(demo.DemoEdgeService1ID, demo.DemoEdgeService1Port)
+	config.MustLoad("edgeservice-demo1", &cfg)
+	logging.MustSetup(cfg.Log)
+	edgeservice.Run(cfg.ServiceID, cfg.Port)
 }
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"github.com/rectcircle/expose-edge-service-demo/config"
 	"github.com/rectcircle/expose-edge-service-demo/demo"
 	"github.com/rectcircle/expose-edge-service-demo/edgeservice"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
 )
 
 func main() {
-	edgeservice.Run(demo.DemoEdgeService2ID, demo.DemoEdgeService2Port)
+	cfg := config.DefaultEdgeServiceConfig(demo.DemoEdgeService2ID, demo.DemoEdgeService2Port)
+	config.MustLoad("edgeservice-demo2", &cfg)
+	logging.MustSetup(cfg.Log)
+	edgeservice.Run(cfg.ServiceID, cfg.Port)
 }
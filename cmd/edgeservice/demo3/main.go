@@ -0,0 +1,15 @@
+package main
+
+import (
+	"github.com/rectcircle/expose-edge-service-demo/config"
+	"github.com/rectcircle/expose-edge-service-demo/demo"
+	"github.com/rectcircle/expose-edge-service-demo/edgeservice"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+)
+
+func main() {
+	cfg := config.DefaultEdgeServiceConfig(demo.DemoEdgeService3ID, demo.DemoEdgeService3Port)
+	config.MustLoad("edgeservice-demo3", &cfg)
+	logging.MustSetup(cfg.Log)
+	edgeservice.RunUDPEcho(cfg.ServiceID, cfg.Port)
+}
@@ -1,35 +1,71 @@
 package main
 
 import (
-	"github.com/rectcircle/expose-edge-service-demo/demo"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/auth"
+	"github.com/rectcircle/expose-edge-service-demo/config"
 	"github.com/rectcircle/expose-edge-service-demo/exposer"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+	"github.com/rectcircle/expose-edge-service-demo/metrics"
 )
 
-// 每个设备应该有一个唯一的设备 ID，这一块应该在出厂时，固定到设备里。在此使用测试值
-const DeviceID = demo.DemoEdgeDeviceID
-
-// 每个设备需要声明，需要暴露的服务的信息，一般从设备的配置文件中读取。目前模拟暴露 demo1 和 demo2 两个服务。
-var ExposeServiceInstances = []struct {
-	EdgeServiceID        string
-	EdgeServiceLocalPort int
-}{
-	{
-		EdgeServiceID:        demo.DemoEdgeService1ID,
-		EdgeServiceLocalPort: demo.DemoEdgeService1Port,
-	},
-	{
-		EdgeServiceID:        demo.DemoEdgeService2ID,
-		EdgeServiceLocalPort: demo.DemoEdgeService2Port,
-	},
-}
-
 func main() {
+	// 每个设备应该有一个唯一的设备 ID 和设备密钥，出厂时写入设备的配置文件。默认使用演示值
+	cfg := config.DefaultClientConfig()
+	path := config.MustLoad("exposer-client", &cfg)
+	logger := logging.MustSetup(cfg.Log).With(logging.KeyComponent, metrics.ComponentExposerClient)
+
 	// 创建一个 exposer 客户端
-	c := exposer.NewExposerClient(DeviceID, demo.ExposerServerURL)
+	c := exposer.NewExposerClient(cfg.DeviceID, cfg.ServerURL)
+	c.Logger = logger
+	secret := []byte(cfg.DeviceSecret)
+	if len(secret) == 0 {
+		secret = auth.DeriveDeviceSecret([]byte(cfg.AuthMasterSecret), cfg.DeviceID)
+	}
+	c.Signer = &auth.HMACSigner{Secret: secret}
+	if strings.HasPrefix(cfg.ServerURL, "wss://") {
+		// 已通过配置校验
+		c.TLSConfig, _ = cfg.TLS.Load()
+	}
+	// 已通过配置校验
+	c.AllowedCIDRs, _ = exposer.ParseCIDRs(cfg.AllowedCIDRs)
+	c.UDPIdleTimeout = time.Duration(cfg.UDPIdleTimeout)
+	c.ReconnectPolicy = cfg.Reconnect.Policy()
+	// 放弃重连后以非 0 状态退出，由进程管理器决定是否重启
+	c.ReconnectPolicy.OnGiveUp = func(string, int, error) { os.Exit(1) }
+	// 本地 /metrics 端口，默认仅监听 loopback
+	if cfg.MetricsAddr != "" {
+		go func() {
+			if err := metrics.ListenAndServe(cfg.MetricsAddr); err != nil {
+				logger.Error("metrics server error", logging.Err(err))
+			}
+		}()
+	}
+	// 本地控制接口，设备上的应用可以通过 edgectl 在运行时暴露服务
+	if cfg.ControlSocket != "" {
+		go func() {
+			if err := c.ServeControlAPI(cfg.ControlSocket); err != nil {
+				logger.Error("control api error", logging.Err(err))
+			}
+		}()
+	}
 	// 将服务暴露到 exposer server 中
-	for _, instance := range ExposeServiceInstances {
-		c.Expose(instance.EdgeServiceID, instance.EdgeServiceLocalPort)
+	for id, target := range cfg.ServiceTargets() {
+		if err := c.ExposeTarget(id, target); err != nil {
+			logger.Error("expose error", logging.KeyServiceID, id, logging.Err(err))
+		}
 	}
+	// 配置文件变化或收到 SIGHUP 时重新加载服务列表，其他配置项需要重启生效
+	c.WatchReload(path, func() (map[string]exposer.Target, error) {
+		cfg := config.DefaultClientConfig()
+		if _, err := config.Load("exposer-client", os.Args[1:], &cfg); err != nil {
+			return nil, err
+		}
+		return cfg.ServiceTargets(), nil
+	})
 	// 等待信号
 	c.WaitSignal()
 }
@@ -1,14 +1,90 @@
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/auth"
+	"github.com/rectcircle/expose-edge-service-demo/config"
 	"github.com/rectcircle/expose-edge-service-demo/demo"
 	"github.com/rectcircle/expose-edge-service-demo/exposer"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+	"github.com/rectcircle/expose-edge-service-demo/metrics"
 )
 
 func main() {
-	s, err := exposer.NewExposerServer(demo.ExposerServerPort)
+	cfg := config.DefaultServerConfig()
+	config.MustLoad("exposer-server", &cfg)
+	logger := logging.MustSetup(cfg.Log).With(logging.KeyComponent, metrics.ComponentExposerServer)
+
+	routeTable, err := config.OpenRouteTable(cfg.RouteTable, cfg.RedisAddr)
+	if err != nil {
+		panic(err)
+	}
+	rt := metrics.InstrumentRouteTable(routeTable)
+	// 设备会话结束（路由删除）后删除 access 指标中该设备服务的时间序列，包括本节点转发的 access 请求
+	if err := metrics.DeleteAccessSeriesOnRouteDelete(context.Background(), rt, metrics.ComponentExposerServer); err != nil {
+		panic(err)
+	}
+	s, err := exposer.NewExposerServer(cfg.Port, rt)
+	if err != nil {
+		panic(err)
+	}
+	s.Logger = logger
+	s.MaxForwardHops = cfg.MaxForwardHops
+	if cfg.PeerSecret != "" {
+		s.PeerSecret = []byte(cfg.PeerSecret)
+	}
+	// 设备密钥：每个设备单独的密钥文件，或由主密钥派生（已通过配置校验，二者只有一个）
+	var secrets auth.SecretStore = &auth.DerivedSecretStore{Master: []byte(cfg.AuthMasterSecret)}
+	if cfg.SecretsFile != "" {
+		if secrets, err = auth.LoadSecretsFile(cfg.SecretsFile); err != nil {
+			panic(err)
+		}
+	}
+	s.Authenticator = auth.NewHMACAuthenticator(secrets)
+	if cfg.TLS.Enabled() {
+		// 已通过配置校验
+		s.TLSConfig, _ = cfg.TLS.Load()
+		s.PeerTLSConfig, _ = cfg.TLS.LoadPeer()
+		if cfg.TLS.ClientCAFile != "" {
+			// 携带客户端证书的设备使用证书中的设备 ID 认证
+			certAuth := &auth.ClientCertAuthenticator{Fallback: s.Authenticator}
+			if cfg.RequireDeviceCert {
+				certAuth.Fallback = nil
+			}
+			s.Authenticator = certAuth
+		}
+	}
+	s.AccessAuthorizer, err = demo.NewAccessAuthorizer(cfg.BearerTokensFile, cfg.APIKeysFile, cfg.AccessPolicyFile)
 	if err != nil {
 		panic(err)
 	}
-	s.Run()
+	if cfg.AdminTokensFile != "" {
+		s.AdminResolver, err = auth.LoadBearerTokensFile(cfg.AdminTokensFile)
+		if err != nil {
+			panic(err)
+		}
+	}
+	// 收到信号后优雅下线
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
+		sno := <-sig
+		logger.Info("receive signal", "signal", sno.String())
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout))
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			logger.Error("shutdown error", logging.Err(err))
+		}
+	}()
+	if err := s.Run(); err != nil {
+		panic(err)
+	}
+	<-done
 }
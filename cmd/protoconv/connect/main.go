@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/config"
+	"github.com/rectcircle/expose-edge-service-demo/demo"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+	"github.com/rectcircle/expose-edge-service-demo/metrics"
+	"github.com/rectcircle/expose-edge-service-demo/protoconv"
+)
+
+func main() {
+	// 配置项
+	cfg := config.DefaultConnectProtoConvConfig()
+	config.MustLoad("connect-protoconv", &cfg)
+	logger := logging.MustSetup(cfg.Log).With(logging.KeyComponent, metrics.ComponentConnectProtoConv)
+
+	// 全局路由表
+	routeTable, err := config.OpenRouteTable(cfg.RouteTable, cfg.RedisAddr)
+	if err != nil {
+		panic(err)
+	}
+	rt := metrics.InstrumentRouteTable(routeTable)
+	// 设备会话结束（路由删除）后删除 access 指标中该设备服务的时间序列
+	if err := metrics.DeleteAccessSeriesOnRouteDelete(context.Background(), rt, metrics.ComponentConnectProtoConv); err != nil {
+		panic(err)
+	}
+
+	// 代理端口只处理 CONNECT，/metrics 使用单独的端口
+	go func() {
+		if err := metrics.ListenAndServe(fmt.Sprintf(":%d", cfg.MetricsPort)); err != nil {
+			logger.Error("metrics server error", logging.Err(err))
+		}
+	}()
+
+	// 已通过配置校验
+	hosts, _ := protoconv.NewHostRouteResolver(cfg.HostTemplate)
+	p := protoconv.NewConnectProtoConv(rt, hosts)
+	p.Logger = logger
+	p.RouteCacheTTL = time.Duration(cfg.RouteCacheTTL)
+	// 调用方鉴权：Proxy-Authorization 认证身份，访问策略决策
+	authorizer, err := demo.NewProxyAuthorizer(cfg.BearerTokensFile, cfg.PasswordsFile, cfg.AccessPolicyFile)
+	if err != nil {
+		panic(err)
+	}
+	p.Authorizer = authorizer
+	// 协议转换服务访问 exposer server 时使用自己的凭证
+	p.Dialer.Header = http.Header{"Authorization": {"Bearer " + cfg.Token}}
+	if cfg.ExposerTLS {
+		// 已通过配置校验
+		p.Dialer.TLSConfig, _ = cfg.TLS.Load()
+	}
+
+	logger.Info("listening", "port", cfg.Port, "host_template", cfg.HostTemplate)
+	// CONNECT 请求没有路径，直接使用 ConnectProtoConv 处理全部请求
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.Port), p); err != nil {
+		panic(err)
+	}
+}
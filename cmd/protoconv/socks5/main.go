@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/auth"
+	"github.com/rectcircle/expose-edge-service-demo/config"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+	"github.com/rectcircle/expose-edge-service-demo/metrics"
+	"github.com/rectcircle/expose-edge-service-demo/policy"
+	"github.com/rectcircle/expose-edge-service-demo/protoconv"
+)
+
+// 本例中均为演示，不可以用于生产。
+
+func main() {
+	// 配置
+	cfg := config.DefaultSOCKS5ProtoConvConfig()
+	config.MustLoad("socks5-protoconv", &cfg)
+	logger := logging.MustSetup(cfg.Log).With(logging.KeyComponent, metrics.ComponentSOCKS5ProtoConv)
+
+	// 全局路由表
+	routeTable, err := config.OpenRouteTable(cfg.RouteTable, cfg.RedisAddr)
+	if err != nil {
+		panic(err)
+	}
+	rt := metrics.InstrumentRouteTable(routeTable)
+	// 设备会话结束（路由删除）后删除 access 指标中该设备服务的时间序列
+	if err := metrics.DeleteAccessSeriesOnRouteDelete(context.Background(), rt, metrics.ComponentSOCKS5ProtoConv); err != nil {
+		panic(err)
+	}
+
+	go func() {
+		if err := metrics.ListenAndServe(fmt.Sprintf(":%d", cfg.MetricsPort)); err != nil {
+			logger.Error("metrics server error", logging.Err(err))
+		}
+	}()
+	listen, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Port))
+	if err != nil {
+		panic(err)
+	}
+	defer listen.Close()
+	logger.Info("server listening", "port", cfg.Port, "host_template", cfg.HostTemplate)
+
+	// 已通过配置校验
+	hosts, _ := protoconv.NewHostRouteResolver(cfg.HostTemplate)
+	p := protoconv.NewSOCKS5ProtoConv(rt, hosts)
+	p.Logger = logger
+	p.RouteCacheTTL = time.Duration(cfg.RouteCacheTTL)
+	// 调用方鉴权：用户名密码认证身份，访问策略决策
+	if cfg.PasswordsFile != "" {
+		if p.Passwords, err = auth.LoadPasswordsFile(cfg.PasswordsFile); err != nil {
+			panic(err)
+		}
+	}
+	accessPolicy, err := policy.LoadFile(cfg.AccessPolicyFile)
+	if err != nil {
+		panic(err)
+	}
+	engine := policy.NewEngine(nil, accessPolicy)
+	engine.Logger = logger
+	p.Authorizer = engine
+	// 协议转换服务访问 exposer server 时使用自己的凭证
+	p.Dialer.Header = http.Header{"Authorization": {"Bearer " + cfg.Token}}
+	if cfg.ExposerTLS {
+		// 已通过配置校验
+		p.Dialer.TLSConfig, _ = cfg.TLS.Load()
+	}
+	if err := p.Serve(listen); err != nil {
+		panic(err) // 应该有完善的错误处理
+	}
+}
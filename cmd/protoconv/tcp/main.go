@@ -1,75 +1,74 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/go-redis/redis"
-	"github.com/gorilla/websocket"
-	"github.com/rectcircle/expose-edge-service-demo/demo"
-	"github.com/rectcircle/expose-edge-service-demo/exposer"
+	"github.com/rectcircle/expose-edge-service-demo/config"
 	"github.com/rectcircle/expose-edge-service-demo/helper"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+	"github.com/rectcircle/expose-edge-service-demo/metrics"
+	"github.com/rectcircle/expose-edge-service-demo/protoconv"
 )
 
 // 本例中均为演示，不可以用于生产。
 
 func main() {
 	// 配置
-	edgeDeviceID := demo.TCPProtoConvDeviceID
-	edgeServiceID := demo.TCPProtoConvServiceID
-	port := demo.TCPProtoConvPort
-	redisAddr := demo.DemoRedisAddr
+	cfg := config.DefaultTCPProtoConvConfig()
+	path := config.MustLoad("tcp-protoconv", &cfg)
+	logger := logging.MustSetup(cfg.Log).With(logging.KeyComponent, metrics.ComponentTCPProtoConv)
 
 	// 全局路由表
-	rdb := redis.NewClient(&redis.Options{Addr: redisAddr})
-	IPPort, err := rdb.Get(helper.RouteKey(edgeServiceID, edgeDeviceID)).Result()
+	routeTable, err := config.OpenRouteTable(cfg.RouteTable, cfg.RedisAddr)
 	if err != nil {
-		panic(err) // 应该有完善的错误处理
-	}
-	if IPPort == "" {
-		panic("not route found") // 应该有完善的错误处理
+		panic(err)
 	}
-	listen, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
+	rt := metrics.InstrumentRouteTable(routeTable)
+	// 设备会话结束（路由删除）后删除 access 指标中该设备服务的时间序列
+	if err := metrics.DeleteAccessSeriesOnRouteDelete(context.Background(), rt, metrics.ComponentTCPProtoConv); err != nil {
 		panic(err)
 	}
-	defer listen.Close()
-	log.Printf("[tcp proto conv][device %s, service %s] server listening :%d", edgeDeviceID, edgeServiceID, port)
 
-	for {
-		conn, err := listen.Accept()
-		if err != nil {
-			panic(err) // 应该有完善的错误处理
+	go func() {
+		if err := metrics.ListenAndServe(fmt.Sprintf(":%d", cfg.MetricsPort)); err != nil {
+			logger.Error("metrics server error", logging.Err(err))
 		}
-		log.Printf("[tcp proto conv][device %s, service %s] accept success", edgeDeviceID, edgeServiceID)
-		go proxy(conn, IPPort, edgeDeviceID, edgeServiceID)
-	}
-}
+	}()
 
-func proxy(conn net.Conn, IPPort string, edgeDeviceID, edgeServiceID string) {
-	defer conn.Close()
-	// 构造 http 路由需要的 header
-	header := http.Header{}
-	header.Add(exposer.EdgeDeviceIDHeaderKey, edgeDeviceID)
-	header.Add(exposer.EdgeServiceIDHeaderKey, edgeServiceID)
-	header.Add(exposer.EdgeFlowTypeHeaderKey, string(exposer.EdgeFlowTypeAccess))
-	// 打开 websocket 连接
-	exposerServerURL := "ws://" + IPPort
-	c, _, err := websocket.DefaultDialer.Dial(exposerServerURL, header)
-	if err != nil {
-		log.Printf("[tcp proto conv][device %s, service %s] proxy connect to %s error: %s", edgeDeviceID, edgeDeviceID, exposerServerURL, err.Error())
-		return
+	p := protoconv.NewTCPProtoConv(rt)
+	p.Logger = logger
+	p.RouteCacheTTL = time.Duration(cfg.RouteCacheTTL)
+	// 协议转换服务访问 exposer server 时使用自己的凭证
+	p.Dialer.Header = http.Header{"Authorization": {"Bearer " + cfg.Token}}
+	if cfg.ExposerTLS {
+		// 已通过配置校验
+		p.Dialer.TLSConfig, _ = cfg.TLS.Load()
 	}
-	log.Printf("[tcp proto conv][device %s, service %s] proxy connect to %s success", edgeDeviceID, edgeDeviceID, exposerServerURL)
-	// 包装成 tcp 连接
-	nextConn := &helper.WebsocketConnWrapper{WsConn: c}
-	defer nextConn.Close()
-	err = helper.IORelay(nextConn, conn)
-	if err != nil {
-		log.Printf("[tcp proto conv][device %s, service %s] proxy IORelay to %s error: %s", edgeDeviceID, edgeDeviceID, exposerServerURL, err.Error())
-		return
+	if _, _, _, err := p.Apply(cfg.TCPListeners()); err != nil {
+		logger.Error("apply listeners error", logging.Err(err))
 	}
-	log.Printf("[tcp proto conv][device %s, service %s] proxy to %s finish", edgeDeviceID, edgeDeviceID, exposerServerURL)
+	// 配置文件变化或收到 SIGHUP 时重新加载监听表，其他配置项需要重启生效
+	helper.WatchReload(path, 2*time.Second, nil, func(reason string) {
+		logger.Info("reload triggered", "reason", reason, "path", path)
+		cfg := config.DefaultTCPProtoConvConfig()
+		if _, err := config.Load("tcp-protoconv", os.Args[1:], &cfg); err != nil {
+			logger.Error("reload listeners error, keep current listeners", logging.Err(err))
+			return
+		}
+		if _, _, _, err := p.Apply(cfg.TCPListeners()); err != nil {
+			logger.Error("apply listeners error", logging.Err(err))
+		}
+	})
+	// 等待信号
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
+	sno := <-sig
+	logger.Info("receive signal", "signal", sno.String())
+	p.Close()
 }
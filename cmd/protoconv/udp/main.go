@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/config"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+	"github.com/rectcircle/expose-edge-service-demo/metrics"
+	"github.com/rectcircle/expose-edge-service-demo/protoconv"
+)
+
+// 本例中均为演示，不可以用于生产。
+
+func main() {
+	// 配置
+	cfg := config.DefaultUDPProtoConvConfig()
+	config.MustLoad("udp-protoconv", &cfg)
+	logger := logging.MustSetup(cfg.Log).With(logging.KeyComponent, metrics.ComponentUDPProtoConv)
+
+	// 全局路由表
+	routeTable, err := config.OpenRouteTable(cfg.RouteTable, cfg.RedisAddr)
+	if err != nil {
+		panic(err)
+	}
+	rt := metrics.InstrumentRouteTable(routeTable)
+	// 设备会话结束（路由删除）后删除 access 指标中该设备服务的时间序列
+	if err := metrics.DeleteAccessSeriesOnRouteDelete(context.Background(), rt, metrics.ComponentUDPProtoConv); err != nil {
+		panic(err)
+	}
+
+	go func() {
+		if err := metrics.ListenAndServe(fmt.Sprintf(":%d", cfg.MetricsPort)); err != nil {
+			logger.Error("metrics server error", logging.Err(err))
+		}
+	}()
+	pc, err := net.ListenPacket("udp", fmt.Sprintf(":%d", cfg.Port))
+	if err != nil {
+		panic(err)
+	}
+	defer pc.Close()
+	logger.Info("server listening udp", logging.KeyDeviceID, cfg.DeviceID, logging.KeyServiceID, cfg.ServiceID, "port", cfg.Port)
+
+	p := protoconv.NewUDPProtoConv(rt, cfg.DeviceID, cfg.ServiceID)
+	p.Logger = logger
+	p.IdleTimeout = time.Duration(cfg.IdleTimeout)
+	p.MaxFlows = cfg.MaxFlows
+	p.FlowRate = cfg.FlowRate
+	// 协议转换服务访问 exposer server 时使用自己的凭证
+	p.Dialer.Header = http.Header{"Authorization": {"Bearer " + cfg.Token}}
+	if cfg.ExposerTLS {
+		// 已通过配置校验
+		p.Dialer.TLSConfig, _ = cfg.TLS.Load()
+	}
+	if err := p.Serve(pc); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,618 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/demo"
+	"github.com/rectcircle/expose-edge-service-demo/exposer"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+	"github.com/rectcircle/expose-edge-service-demo/protoconv"
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
+	"github.com/rectcircle/expose-edge-service-demo/tlsconfig"
+)
+
+// 各个命令的配置，默认值为 demo 包中的演示值，不需要配置文件即可运行 README 中的示例。
+
+// ServerConfig cmd/exposer/server 的配置
+type ServerConfig struct {
+	Port             int    `json:"port" yaml:"port" env:"EDGE_SERVER_PORT" flag:"port" usage:"监听端口，同时提供 /metrics"`
+	RedisAddr        string `json:"redis_addr" yaml:"redis_addr" env:"EDGE_REDIS_ADDR" flag:"redis-addr" usage:"路由表 redis 地址，route_table 为空时使用"`
+	RouteTable       string `json:"route_table" yaml:"route_table" env:"EDGE_ROUTE_TABLE" flag:"route-table" usage:"路由表后端：redis://host:port、file:/path/to/routes.json 或 memory://，为空时使用 redis_addr"`
+	AuthMasterSecret string `json:"auth_master_secret" yaml:"auth_master_secret" env:"EDGE_AUTH_MASTER_SECRET" flag:"auth-master-secret" usage:"设备密钥的派生主密钥，与 secrets_file 二选一"`
+	// SecretsFile 每个设备单独的密钥，参见 auth.LoadSecretsFile
+	SecretsFile      string `json:"secrets_file" yaml:"secrets_file" env:"EDGE_SECRETS_FILE" flag:"secrets-file" usage:"设备密钥文件，每行 <device-id> <secret>，与 auth_master_secret 二选一"`
+	BearerTokensFile string `json:"bearer_tokens_file" yaml:"bearer_tokens_file" env:"EDGE_BEARER_TOKENS_FILE" flag:"bearer-tokens-file" usage:"access 调用方 bearer token 文件"`
+	APIKeysFile      string `json:"api_keys_file" yaml:"api_keys_file" env:"EDGE_API_KEYS_FILE" flag:"api-keys-file" usage:"access 调用方 api key 文件 (X-Edge-API-Key)，为空时不支持 api key"`
+	AccessPolicyFile string `json:"access_policy_file" yaml:"access_policy_file" env:"EDGE_ACCESS_POLICY_FILE" flag:"access-policy-file" usage:"access 访问策略文件"`
+	AdminTokensFile  string `json:"admin_tokens_file" yaml:"admin_tokens_file" env:"EDGE_ADMIN_TOKENS_FILE" flag:"admin-tokens-file" usage:"管理接口调用方 bearer token 文件，为空时不提供管理接口"`
+	MaxForwardHops   int    `json:"max_forward_hops" yaml:"max_forward_hops" env:"EDGE_MAX_FORWARD_HOPS" flag:"max-forward-hops" usage:"access 请求在节点间转发的最大跳数"`
+	// PeerSecret 参见 exposer.ExposerServer.PeerSecret，不提供默认值：公开的演示密钥可以伪造转发请求、绕过鉴权
+	PeerSecret      string   `json:"peer_secret" yaml:"peer_secret" env:"EDGE_PEER_SECRET" flag:"peer-secret" usage:"集群内节点共享的转发签名密钥，配置后目标节点信任转发节点鉴权的调用方身份（支持转发 mTLS 调用方），为空时目标节点重新鉴权，只能转发 bearer token、api key 凭证"`
+	ShutdownTimeout Duration `json:"shutdown_timeout" yaml:"shutdown_timeout" env:"EDGE_SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" usage:"下线时等待 access 请求结束的最长时间"`
+	// RequireDeviceCert 设备必须使用客户端证书认证，否则没有证书的设备可以使用 HMAC 签名认证
+	RequireDeviceCert bool `json:"require_device_cert" yaml:"require_device_cert" env:"EDGE_REQUIRE_DEVICE_CERT" flag:"require-device-cert" usage:"设备必须使用客户端证书认证，需要配置 tls.client_ca_file"`
+
+	TLS tlsconfig.ServerConfig `json:"tls" yaml:"tls"`
+	Log logging.Config         `json:"log" yaml:"log"`
+}
+
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		Port:             demo.ExposerServerPort,
+		RedisAddr:        demo.DemoRedisAddr,
+		AuthMasterSecret: demo.DemoAuthMasterSecret,
+		BearerTokensFile: demo.DemoBearerTokensFile,
+		APIKeysFile:      demo.DemoAPIKeysFile,
+		AccessPolicyFile: demo.DemoAccessPolicyFile,
+		AdminTokensFile:  demo.DemoAdminTokensFile,
+		MaxForwardHops:   1,
+		ShutdownTimeout:  Duration(30 * time.Second),
+		Log:              defaultLogConfig(),
+	}
+}
+
+func (c *ServerConfig) Validate() error {
+	return errors.Join(
+		validPort("port", c.Port),
+		validRouteTable(c.RouteTable, c.RedisAddr),
+		check(c.AuthMasterSecret != "" || c.SecretsFile != "", "auth_master_secret, secrets_file: one must be set"),
+		check(c.AuthMasterSecret == "" || c.SecretsFile == "", "secrets_file: must not be combined with auth_master_secret, set auth_master_secret to empty"),
+		nonEmpty("bearer_tokens_file", c.BearerTokensFile),
+		nonEmpty("access_policy_file", c.AccessPolicyFile),
+		check(c.MaxForwardHops >= 0, "max_forward_hops: must not be negative, got %d", c.MaxForwardHops),
+		check(c.ShutdownTimeout > 0, "shutdown_timeout: must be positive, got %s", c.ShutdownTimeout),
+		check(!c.RequireDeviceCert || c.TLS.ClientCAFile != "", "require_device_cert: tls.client_ca_file must be set"),
+		validTLS(c.TLS),
+		validLog(c.Log),
+	)
+}
+
+// ServiceConfig 设备上需要暴露的一个服务，Target 和 Port 二选一，Port 等价于 localhost:<port>
+type ServiceConfig struct {
+	ID     string `json:"id" yaml:"id"`
+	Port   int    `json:"port,omitempty" yaml:"port,omitempty"`
+	Target string `json:"target,omitempty" yaml:"target,omitempty"` // 参见 exposer.Target
+}
+
+func (s ServiceConfig) target() (exposer.Target, error) {
+	if s.Target != "" {
+		return exposer.ParseTarget(s.Target)
+	}
+	if s.Port <= 0 || s.Port > 65535 {
+		return exposer.Target{}, fmt.Errorf("port must be in 1-65535, got %d", s.Port)
+	}
+	return exposer.LocalPortTarget(s.Port), nil
+}
+
+// ReconnectConfig exposer client 的重连策略，参见 exposer.ReconnectPolicy
+type ReconnectConfig struct {
+	InitialInterval Duration `json:"initial_interval" yaml:"initial_interval" env:"EDGE_RECONNECT_INITIAL_INTERVAL" flag:"reconnect-initial-interval" usage:"第一次重连前等待时间的上限"`
+	MaxInterval     Duration `json:"max_interval" yaml:"max_interval" env:"EDGE_RECONNECT_MAX_INTERVAL" flag:"reconnect-max-interval" usage:"重连前等待时间的上限"`
+	Multiplier      float64  `json:"multiplier" yaml:"multiplier" env:"EDGE_RECONNECT_MULTIPLIER" flag:"reconnect-multiplier" usage:"每次重连失败后等待时间上限的倍数，不小于 1"`
+	MaxAttempts     int      `json:"max_attempts" yaml:"max_attempts" env:"EDGE_RECONNECT_MAX_ATTEMPTS" flag:"reconnect-max-attempts" usage:"连续失败多少次后放弃重连并退出，0 表示永不放弃"`
+}
+
+func defaultReconnectConfig() ReconnectConfig {
+	p := exposer.DefaultReconnectPolicy()
+	return ReconnectConfig{
+		InitialInterval: Duration(p.InitialInterval),
+		MaxInterval:     Duration(p.MaxInterval),
+		Multiplier:      p.Multiplier,
+		MaxAttempts:     p.MaxAttempts,
+	}
+}
+
+// Policy 转换为 exposer.ReconnectPolicy
+func (c ReconnectConfig) Policy() exposer.ReconnectPolicy {
+	return exposer.ReconnectPolicy{
+		InitialInterval: time.Duration(c.InitialInterval),
+		MaxInterval:     time.Duration(c.MaxInterval),
+		Multiplier:      c.Multiplier,
+		MaxAttempts:     c.MaxAttempts,
+	}
+}
+
+// ClientConfig cmd/exposer/client 的配置。暴露的服务列表只能通过配置文件设置。
+type ClientConfig struct {
+	DeviceID  string `json:"device_id" yaml:"device_id" env:"EDGE_DEVICE_ID" flag:"device-id" usage:"设备 ID"`
+	ServerURL string `json:"server_url" yaml:"server_url" env:"EDGE_SERVER_URL" flag:"server-url" usage:"exposer server 地址，ws://host:port 或 wss://host:port"`
+	// DeviceSecret 设备密钥，为空时使用 AuthMasterSecret 派生（仅用于演示）
+	DeviceSecret     string          `json:"device_secret" yaml:"device_secret" env:"EDGE_DEVICE_SECRET" flag:"device-secret" usage:"设备密钥"`
+	AuthMasterSecret string          `json:"auth_master_secret" yaml:"auth_master_secret" env:"EDGE_AUTH_MASTER_SECRET" flag:"auth-master-secret" usage:"未配置设备密钥时，用于派生设备密钥的主密钥（仅用于演示）"`
+	MetricsAddr      string          `json:"metrics_addr" yaml:"metrics_addr" env:"EDGE_METRICS_ADDR" flag:"metrics-addr" usage:"/metrics 监听地址，为空时不提供"`
+	ControlSocket    string          `json:"control_socket" yaml:"control_socket" env:"EDGE_CONTROL_SOCKET" flag:"control-socket" usage:"本地控制接口的 unix socket 路径，为空时不提供"`
+	AllowedCIDRs     []string        `json:"allowed_cidrs" yaml:"allowed_cidrs" env:"EDGE_ALLOWED_CIDRS" flag:"allowed-cidrs" usage:"服务的 tcp、udp 目标地址允许的网段，逗号分隔"`
+	UDPIdleTimeout   Duration        `json:"udp_idle_timeout" yaml:"udp_idle_timeout" env:"EDGE_UDP_IDLE_TIMEOUT" flag:"udp-idle-timeout" usage:"udp flow 的空闲超时时间"`
+	Services         []ServiceConfig `json:"services" yaml:"services"`
+
+	Reconnect ReconnectConfig `json:"reconnect" yaml:"reconnect"`
+	// TLS server_url 为 wss:// 时使用
+	TLS tlsconfig.ClientConfig `json:"tls" yaml:"tls"`
+	Log logging.Config         `json:"log" yaml:"log"`
+}
+
+func DefaultClientConfig() ClientConfig {
+	return ClientConfig{
+		DeviceID:         demo.DemoEdgeDeviceID,
+		ServerURL:        demo.ExposerServerURL,
+		AuthMasterSecret: demo.DemoAuthMasterSecret,
+		MetricsAddr:      fmt.Sprintf("127.0.0.1:%d", demo.ExposerClientMetricsPort),
+		ControlSocket:    demo.ExposerClientControlSocket,
+		AllowedCIDRs:     []string{"127.0.0.0/8", "::1/128"},
+		UDPIdleTimeout:   Duration(time.Minute),
+		Services: []ServiceConfig{
+			{ID: demo.DemoEdgeService1ID, Port: demo.DemoEdgeService1Port},
+			{ID: demo.DemoEdgeService2ID, Port: demo.DemoEdgeService2Port},
+			{ID: demo.DemoEdgeService3ID, Target: fmt.Sprintf("udp://localhost:%d", demo.DemoEdgeService3Port)},
+		},
+		Reconnect: defaultReconnectConfig(),
+		Log:       defaultLogConfig(),
+	}
+}
+
+func (c *ClientConfig) Validate() error {
+	errs := []error{
+		validID("device_id", c.DeviceID),
+		validWSURL("server_url", c.ServerURL),
+		check(c.DeviceSecret != "" || c.AuthMasterSecret != "", "device_secret: must not be empty when auth_master_secret is not set"),
+		validOptionalHostPort("metrics_addr", c.MetricsAddr),
+		check(c.UDPIdleTimeout > 0, "udp_idle_timeout: must be positive, got %s", c.UDPIdleTimeout),
+		validReconnect(c.Reconnect),
+		check(c.TLS.IsZero() || strings.HasPrefix(c.ServerURL, "wss://"), "tls: server_url must be wss:// when tls options are set"),
+		validTLS(c.TLS),
+		validLog(c.Log),
+	}
+	if _, err := exposer.ParseCIDRs(c.AllowedCIDRs); err != nil {
+		errs = append(errs, fmt.Errorf("allowed_cidrs: %w", err))
+	}
+	seen := map[string]bool{}
+	for i, s := range c.Services {
+		name := fmt.Sprintf("services[%d]", i)
+		errs = append(errs,
+			validID(name+".id", s.ID),
+			check(!seen[s.ID], "%s.id: duplicate service %q", name, s.ID),
+			check(s.Port == 0 || s.Target == "", "%s: set either port or target, not both", name),
+		)
+		if _, err := s.target(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+		seen[s.ID] = true
+	}
+	return errors.Join(errs...)
+}
+
+// ServiceTargets 返回 <service-id> => 目标地址，需要先通过 Validate 校验
+func (c *ClientConfig) ServiceTargets() map[string]exposer.Target {
+	targets := make(map[string]exposer.Target, len(c.Services))
+	for _, s := range c.Services {
+		targets[s.ID], _ = s.target()
+	}
+	return targets
+}
+
+// HTTPProtoConvConfig cmd/protoconv/http 的配置
+type HTTPProtoConvConfig struct {
+	Port             int    `json:"port" yaml:"port" env:"EDGE_HTTP_PROTOCONV_PORT" flag:"port" usage:"监听端口"`
+	MetricsPort      int    `json:"metrics_port" yaml:"metrics_port" env:"EDGE_METRICS_PORT" flag:"metrics-port" usage:"/metrics 监听端口"`
+	RedisAddr        string `json:"redis_addr" yaml:"redis_addr" env:"EDGE_REDIS_ADDR" flag:"redis-addr" usage:"路由表 redis 地址，route_table 为空时使用"`
+	RouteTable       string `json:"route_table" yaml:"route_table" env:"EDGE_ROUTE_TABLE" flag:"route-table" usage:"路由表后端：redis://host:port、file:/path/to/routes.json 或 memory://，为空时使用 redis_addr"`
+	BearerTokensFile string `json:"bearer_tokens_file" yaml:"bearer_tokens_file" env:"EDGE_BEARER_TOKENS_FILE" flag:"bearer-tokens-file" usage:"调用方 bearer token 文件"`
+	APIKeysFile      string `json:"api_keys_file" yaml:"api_keys_file" env:"EDGE_API_KEYS_FILE" flag:"api-keys-file" usage:"调用方 api key 文件 (X-Edge-API-Key)，为空时不支持 api key"`
+	AccessPolicyFile string `json:"access_policy_file" yaml:"access_policy_file" env:"EDGE_ACCESS_POLICY_FILE" flag:"access-policy-file" usage:"访问策略文件"`
+	Token            string `json:"token" yaml:"token" env:"EDGE_PROTOCONV_TOKEN" flag:"token" usage:"访问 exposer server 时使用的 bearer token"`
+	// HostTemplate 按 Host 路由的域名模板，例如 {service}.{device}.edge.example.com，为空时只按请求头路由
+	HostTemplate string `json:"host_template" yaml:"host_template" env:"EDGE_HOST_TEMPLATE" flag:"host-template" usage:"按 Host 路由的域名模板，包含 {device} 和 {service}，未匹配时按请求头路由"`
+	// PathTemplate 按路径前缀路由的模板，例如 /devices/{device}/services/{service}，为空时不按路径路由
+	PathTemplate string `json:"path_template" yaml:"path_template" env:"EDGE_PATH_TEMPLATE" flag:"path-template" usage:"按路径前缀路由的模板，包含 {device} 和 {service}，转发时去掉前缀"`
+	// IdleConnTimeout 需要小于 exposer server 的 shutdown_timeout
+	IdleConnTimeout Duration `json:"idle_conn_timeout" yaml:"idle_conn_timeout" env:"EDGE_IDLE_CONN_TIMEOUT" flag:"idle-conn-timeout" usage:"到边缘服务的空闲连接保留的时间"`
+	MaxIdleConns    int      `json:"max_idle_conns" yaml:"max_idle_conns" env:"EDGE_MAX_IDLE_CONNS" flag:"max-idle-conns" usage:"每个 (设备, 服务) 保留的最大空闲连接数"`
+
+	ExposerTLS bool                   `json:"exposer_tls" yaml:"exposer_tls" env:"EDGE_EXPOSER_TLS" flag:"exposer-tls" usage:"使用 wss:// 连接 exposer server"`
+	TLS        tlsconfig.ClientConfig `json:"tls" yaml:"tls"`
+	Log        logging.Config         `json:"log" yaml:"log"`
+}
+
+func DefaultHTTPProtoConvConfig() HTTPProtoConvConfig {
+	return HTTPProtoConvConfig{
+		Port:             demo.HTTPProtoConvPort,
+		MetricsPort:      demo.HTTPProtoConvMetricsPort,
+		RedisAddr:        demo.DemoRedisAddr,
+		BearerTokensFile: demo.DemoBearerTokensFile,
+		APIKeysFile:      demo.DemoAPIKeysFile,
+		AccessPolicyFile: demo.DemoAccessPolicyFile,
+		Token:            demo.DemoProtoConvToken,
+		IdleConnTimeout:  Duration(protoconv.DefaultHTTPIdleConnTimeout),
+		MaxIdleConns:     protoconv.DefaultHTTPMaxIdleConns,
+		Log:              defaultLogConfig(),
+	}
+}
+
+func (c *HTTPProtoConvConfig) Validate() error {
+	return errors.Join(
+		validPort("port", c.Port),
+		validPort("metrics_port", c.MetricsPort),
+		check(c.Port != c.MetricsPort, "metrics_port: must differ from port %d", c.Port),
+		validRouteTable(c.RouteTable, c.RedisAddr),
+		nonEmpty("bearer_tokens_file", c.BearerTokensFile),
+		nonEmpty("access_policy_file", c.AccessPolicyFile),
+		nonEmpty("token", c.Token),
+		validHostTemplate("host_template", c.HostTemplate),
+		validPathTemplate("path_template", c.PathTemplate),
+		check(c.IdleConnTimeout > 0, "idle_conn_timeout: must be positive, got %s", c.IdleConnTimeout),
+		check(c.MaxIdleConns > 0, "max_idle_conns: must be positive, got %d", c.MaxIdleConns),
+		check(c.ExposerTLS || c.TLS.IsZero(), "tls: exposer_tls must be enabled when tls options are set"),
+		validTLS(c.TLS),
+		validLog(c.Log),
+	)
+}
+
+// RouteResolver 依次按 Host、路径前缀、请求头解析请求的目标设备和服务，需要先通过 Validate 校验
+func (c *HTTPProtoConvConfig) RouteResolver() protoconv.RouteResolver {
+	var chain protoconv.ChainRouteResolver
+	if c.HostTemplate != "" {
+		host, _ := protoconv.NewHostRouteResolver(c.HostTemplate)
+		chain = append(chain, host)
+	}
+	if c.PathTemplate != "" {
+		path, _ := protoconv.NewPathRouteResolver(c.PathTemplate)
+		chain = append(chain, path)
+	}
+	if len(chain) == 0 {
+		return protoconv.HeaderRouteResolver{}
+	}
+	return append(chain, protoconv.HeaderRouteResolver{})
+}
+
+// TCPListenerConfig tcp 协议转换服务监听表中的一项
+type TCPListenerConfig struct {
+	Port      int    `json:"port" yaml:"port"`
+	DeviceID  string `json:"device_id" yaml:"device_id"`
+	ServiceID string `json:"service_id" yaml:"service_id"`
+}
+
+// TCPProtoConvConfig cmd/protoconv/tcp 的配置。监听表只能通过配置文件设置，配置文件变化或收到 SIGHUP 时重新加载。
+type TCPProtoConvConfig struct {
+	MetricsPort   int                 `json:"metrics_port" yaml:"metrics_port" env:"EDGE_METRICS_PORT" flag:"metrics-port" usage:"/metrics 监听端口"`
+	RedisAddr     string              `json:"redis_addr" yaml:"redis_addr" env:"EDGE_REDIS_ADDR" flag:"redis-addr" usage:"路由表 redis 地址，route_table 为空时使用"`
+	RouteTable    string              `json:"route_table" yaml:"route_table" env:"EDGE_ROUTE_TABLE" flag:"route-table" usage:"路由表后端：redis://host:port、file:/path/to/routes.json 或 memory://，为空时使用 redis_addr"`
+	Token         string              `json:"token" yaml:"token" env:"EDGE_PROTOCONV_TOKEN" flag:"token" usage:"访问 exposer server 时使用的 bearer token"`
+	RouteCacheTTL Duration            `json:"route_cache_ttl" yaml:"route_cache_ttl" env:"EDGE_ROUTE_CACHE_TTL" flag:"route-cache-ttl" usage:"路由查询结果缓存的时间，0 表示不缓存"`
+	Listeners     []TCPListenerConfig `json:"listeners" yaml:"listeners"`
+
+	ExposerTLS bool                   `json:"exposer_tls" yaml:"exposer_tls" env:"EDGE_EXPOSER_TLS" flag:"exposer-tls" usage:"使用 wss:// 连接 exposer server"`
+	TLS        tlsconfig.ClientConfig `json:"tls" yaml:"tls"`
+	Log        logging.Config         `json:"log" yaml:"log"`
+}
+
+func DefaultTCPProtoConvConfig() TCPProtoConvConfig {
+	return TCPProtoConvConfig{
+		MetricsPort:   demo.TCPProtoConvMetricsPort,
+		RedisAddr:     demo.DemoRedisAddr,
+		Token:         demo.DemoProtoConvToken,
+		RouteCacheTTL: Duration(protoconv.DefaultRouteCacheTTL),
+		Listeners: []TCPListenerConfig{
+			{Port: demo.TCPProtoConvPort, DeviceID: demo.TCPProtoConvDeviceID, ServiceID: demo.TCPProtoConvServiceID},
+		},
+		Log: defaultLogConfig(),
+	}
+}
+
+func (c *TCPProtoConvConfig) Validate() error {
+	errs := []error{
+		validPort("metrics_port", c.MetricsPort),
+		validRouteTable(c.RouteTable, c.RedisAddr),
+		nonEmpty("token", c.Token),
+		check(c.RouteCacheTTL >= 0, "route_cache_ttl: must not be negative, got %s", c.RouteCacheTTL),
+		check(c.ExposerTLS || c.TLS.IsZero(), "tls: exposer_tls must be enabled when tls options are set"),
+		validTLS(c.TLS),
+		validLog(c.Log),
+	}
+	seen := map[int]bool{}
+	for i, l := range c.Listeners {
+		name := fmt.Sprintf("listeners[%d]", i)
+		errs = append(errs,
+			validPort(name+".port", l.Port),
+			check(!seen[l.Port], "%s.port: duplicate port %d", name, l.Port),
+			check(l.Port != c.MetricsPort, "%s.port: must differ from metrics_port %d", name, c.MetricsPort),
+			nonEmpty(name+".device_id", l.DeviceID),
+			nonEmpty(name+".service_id", l.ServiceID),
+		)
+		seen[l.Port] = true
+	}
+	return errors.Join(errs...)
+}
+
+// TCPListeners 返回监听表，需要先通过 Validate 校验
+func (c *TCPProtoConvConfig) TCPListeners() []protoconv.TCPListener {
+	listeners := make([]protoconv.TCPListener, 0, len(c.Listeners))
+	for _, l := range c.Listeners {
+		listeners = append(listeners, protoconv.TCPListener{Port: l.Port, DeviceID: l.DeviceID, ServiceID: l.ServiceID})
+	}
+	return listeners
+}
+
+// UDPProtoConvConfig cmd/protoconv/udp 的配置
+type UDPProtoConvConfig struct {
+	Port        int      `json:"port" yaml:"port" env:"EDGE_UDP_PROTOCONV_PORT" flag:"port" usage:"监听的 udp 端口。不对调用方鉴权，能向该端口发送数据报的任何人都可以访问边缘服务，只能在可信网络中监听"`
+	MetricsPort int      `json:"metrics_port" yaml:"metrics_port" env:"EDGE_METRICS_PORT" flag:"metrics-port" usage:"/metrics 监听端口 (tcp)"`
+	RedisAddr   string   `json:"redis_addr" yaml:"redis_addr" env:"EDGE_REDIS_ADDR" flag:"redis-addr" usage:"路由表 redis 地址，route_table 为空时使用"`
+	RouteTable  string   `json:"route_table" yaml:"route_table" env:"EDGE_ROUTE_TABLE" flag:"route-table" usage:"路由表后端：redis://host:port、file:/path/to/routes.json 或 memory://，为空时使用 redis_addr"`
+	DeviceID    string   `json:"device_id" yaml:"device_id" env:"EDGE_DEVICE_ID" flag:"device-id" usage:"转发到的设备 ID"`
+	ServiceID   string   `json:"service_id" yaml:"service_id" env:"EDGE_SERVICE_ID" flag:"service-id" usage:"转发到的 udp 服务 ID"`
+	Token       string   `json:"token" yaml:"token" env:"EDGE_PROTOCONV_TOKEN" flag:"token" usage:"访问 exposer server 时使用的 bearer token"`
+	IdleTimeout Duration `json:"idle_timeout" yaml:"idle_timeout" env:"EDGE_UDP_IDLE_TIMEOUT" flag:"idle-timeout" usage:"udp flow 的空闲超时时间"`
+	MaxFlows    int      `json:"max_flows" yaml:"max_flows" env:"EDGE_UDP_MAX_FLOWS" flag:"max-flows" usage:"最大 flow（来源地址）个数，超出时丢弃新来源的数据报，0 表示不限制"`
+	FlowRate    int      `json:"flow_rate" yaml:"flow_rate" env:"EDGE_UDP_FLOW_RATE" flag:"flow-rate" usage:"每秒最多新建的 flow 个数，超出时丢弃新来源的数据报，0 表示不限制"`
+
+	ExposerTLS bool                   `json:"exposer_tls" yaml:"exposer_tls" env:"EDGE_EXPOSER_TLS" flag:"exposer-tls" usage:"使用 wss:// 连接 exposer server"`
+	TLS        tlsconfig.ClientConfig `json:"tls" yaml:"tls"`
+	Log        logging.Config         `json:"log" yaml:"log"`
+}
+
+func DefaultUDPProtoConvConfig() UDPProtoConvConfig {
+	return UDPProtoConvConfig{
+		Port:        demo.UDPProtoConvPort,
+		MetricsPort: demo.UDPProtoConvMetricsPort,
+		RedisAddr:   demo.DemoRedisAddr,
+		DeviceID:    demo.UDPProtoConvDeviceID,
+		ServiceID:   demo.UDPProtoConvServiceID,
+		Token:       demo.DemoProtoConvToken,
+		IdleTimeout: Duration(time.Minute),
+		MaxFlows:    1024,
+		FlowRate:    100,
+		Log:         defaultLogConfig(),
+	}
+}
+
+func (c *UDPProtoConvConfig) Validate() error {
+	return errors.Join(
+		validPort("port", c.Port),
+		validPort("metrics_port", c.MetricsPort),
+		validRouteTable(c.RouteTable, c.RedisAddr),
+		nonEmpty("device_id", c.DeviceID),
+		nonEmpty("service_id", c.ServiceID),
+		nonEmpty("token", c.Token),
+		check(c.IdleTimeout > 0, "idle_timeout: must be positive, got %s", c.IdleTimeout),
+		check(c.MaxFlows >= 0, "max_flows: must not be negative, got %d", c.MaxFlows),
+		check(c.FlowRate >= 0, "flow_rate: must not be negative, got %d", c.FlowRate),
+		check(c.ExposerTLS || c.TLS.IsZero(), "tls: exposer_tls must be enabled when tls options are set"),
+		validTLS(c.TLS),
+		validLog(c.Log),
+	)
+}
+
+// SOCKS5ProtoConvConfig cmd/protoconv/socks5 的配置
+type SOCKS5ProtoConvConfig struct {
+	Port             int      `json:"port" yaml:"port" env:"EDGE_SOCKS5_PROTOCONV_PORT" flag:"port" usage:"监听端口"`
+	MetricsPort      int      `json:"metrics_port" yaml:"metrics_port" env:"EDGE_METRICS_PORT" flag:"metrics-port" usage:"/metrics 监听端口"`
+	RedisAddr        string   `json:"redis_addr" yaml:"redis_addr" env:"EDGE_REDIS_ADDR" flag:"redis-addr" usage:"路由表 redis 地址，route_table 为空时使用"`
+	RouteTable       string   `json:"route_table" yaml:"route_table" env:"EDGE_ROUTE_TABLE" flag:"route-table" usage:"路由表后端：redis://host:port、file:/path/to/routes.json 或 memory://，为空时使用 redis_addr"`
+	PasswordsFile    string   `json:"passwords_file" yaml:"passwords_file" env:"EDGE_PASSWORDS_FILE" flag:"passwords-file" usage:"调用方用户名密码文件，为空时不要求认证：代理不鉴权，调用方以 anonymous 身份交给 access_policy_file 决策"`
+	AccessPolicyFile string   `json:"access_policy_file" yaml:"access_policy_file" env:"EDGE_ACCESS_POLICY_FILE" flag:"access-policy-file" usage:"访问策略文件"`
+	Token            string   `json:"token" yaml:"token" env:"EDGE_PROTOCONV_TOKEN" flag:"token" usage:"访问 exposer server 时使用的 bearer token"`
+	HostTemplate     string   `json:"host_template" yaml:"host_template" env:"EDGE_HOST_TEMPLATE" flag:"host-template" usage:"虚拟域名模板，包含 {device} 和 {service}"`
+	RouteCacheTTL    Duration `json:"route_cache_ttl" yaml:"route_cache_ttl" env:"EDGE_ROUTE_CACHE_TTL" flag:"route-cache-ttl" usage:"路由查询结果缓存的时间，0 表示不缓存"`
+
+	ExposerTLS bool                   `json:"exposer_tls" yaml:"exposer_tls" env:"EDGE_EXPOSER_TLS" flag:"exposer-tls" usage:"使用 wss:// 连接 exposer server"`
+	TLS        tlsconfig.ClientConfig `json:"tls" yaml:"tls"`
+	Log        logging.Config         `json:"log" yaml:"log"`
+}
+
+func DefaultSOCKS5ProtoConvConfig() SOCKS5ProtoConvConfig {
+	return SOCKS5ProtoConvConfig{
+		Port:             demo.SOCKS5ProtoConvPort,
+		MetricsPort:      demo.SOCKS5ProtoConvMetricsPort,
+		RedisAddr:        demo.DemoRedisAddr,
+		PasswordsFile:    demo.DemoPasswordsFile,
+		AccessPolicyFile: demo.DemoAccessPolicyFile,
+		Token:            demo.DemoProtoConvToken,
+		HostTemplate:     protoconv.DefaultSOCKS5HostTemplate,
+		RouteCacheTTL:    Duration(protoconv.DefaultRouteCacheTTL),
+		Log:              defaultLogConfig(),
+	}
+}
+
+func (c *SOCKS5ProtoConvConfig) Validate() error {
+	return errors.Join(
+		validPort("port", c.Port),
+		validPort("metrics_port", c.MetricsPort),
+		check(c.Port != c.MetricsPort, "metrics_port: must differ from port %d", c.Port),
+		validRouteTable(c.RouteTable, c.RedisAddr),
+		nonEmpty("access_policy_file", c.AccessPolicyFile),
+		nonEmpty("token", c.Token),
+		nonEmpty("host_template", c.HostTemplate),
+		validHostTemplate("host_template", c.HostTemplate),
+		check(c.RouteCacheTTL >= 0, "route_cache_ttl: must not be negative, got %s", c.RouteCacheTTL),
+		check(c.ExposerTLS || c.TLS.IsZero(), "tls: exposer_tls must be enabled when tls options are set"),
+		validTLS(c.TLS),
+		validLog(c.Log),
+	)
+}
+
+// ConnectProtoConvConfig cmd/protoconv/connect 的配置
+type ConnectProtoConvConfig struct {
+	Port             int      `json:"port" yaml:"port" env:"EDGE_CONNECT_PROTOCONV_PORT" flag:"port" usage:"监听端口"`
+	MetricsPort      int      `json:"metrics_port" yaml:"metrics_port" env:"EDGE_METRICS_PORT" flag:"metrics-port" usage:"/metrics 监听端口"`
+	RedisAddr        string   `json:"redis_addr" yaml:"redis_addr" env:"EDGE_REDIS_ADDR" flag:"redis-addr" usage:"路由表 redis 地址，route_table 为空时使用"`
+	RouteTable       string   `json:"route_table" yaml:"route_table" env:"EDGE_ROUTE_TABLE" flag:"route-table" usage:"路由表后端：redis://host:port、file:/path/to/routes.json 或 memory://，为空时使用 redis_addr"`
+	BearerTokensFile string   `json:"bearer_tokens_file" yaml:"bearer_tokens_file" env:"EDGE_BEARER_TOKENS_FILE" flag:"bearer-tokens-file" usage:"调用方 bearer token 文件，为空时不支持 Proxy-Authorization: Bearer"`
+	PasswordsFile    string   `json:"passwords_file" yaml:"passwords_file" env:"EDGE_PASSWORDS_FILE" flag:"passwords-file" usage:"调用方用户名密码文件，为空时不支持 Proxy-Authorization: Basic"`
+	AccessPolicyFile string   `json:"access_policy_file" yaml:"access_policy_file" env:"EDGE_ACCESS_POLICY_FILE" flag:"access-policy-file" usage:"访问策略文件"`
+	Token            string   `json:"token" yaml:"token" env:"EDGE_PROTOCONV_TOKEN" flag:"token" usage:"访问 exposer server 时使用的 bearer token"`
+	HostTemplate     string   `json:"host_template" yaml:"host_template" env:"EDGE_HOST_TEMPLATE" flag:"host-template" usage:"虚拟域名模板，包含 {device} 和 {service}"`
+	RouteCacheTTL    Duration `json:"route_cache_ttl" yaml:"route_cache_ttl" env:"EDGE_ROUTE_CACHE_TTL" flag:"route-cache-ttl" usage:"路由查询结果缓存的时间，0 表示不缓存"`
+
+	ExposerTLS bool                   `json:"exposer_tls" yaml:"exposer_tls" env:"EDGE_EXPOSER_TLS" flag:"exposer-tls" usage:"使用 wss:// 连接 exposer server"`
+	TLS        tlsconfig.ClientConfig `json:"tls" yaml:"tls"`
+	Log        logging.Config         `json:"log" yaml:"log"`
+}
+
+func DefaultConnectProtoConvConfig() ConnectProtoConvConfig {
+	return ConnectProtoConvConfig{
+		Port:             demo.ConnectProtoConvPort,
+		MetricsPort:      demo.ConnectProtoConvMetricsPort,
+		RedisAddr:        demo.DemoRedisAddr,
+		BearerTokensFile: demo.DemoBearerTokensFile,
+		PasswordsFile:    demo.DemoPasswordsFile,
+		AccessPolicyFile: demo.DemoAccessPolicyFile,
+		Token:            demo.DemoProtoConvToken,
+		HostTemplate:     protoconv.DefaultConnectHostTemplate,
+		RouteCacheTTL:    Duration(protoconv.DefaultRouteCacheTTL),
+		Log:              defaultLogConfig(),
+	}
+}
+
+func (c *ConnectProtoConvConfig) Validate() error {
+	return errors.Join(
+		validPort("port", c.Port),
+		validPort("metrics_port", c.MetricsPort),
+		check(c.Port != c.MetricsPort, "metrics_port: must differ from port %d", c.Port),
+		validRouteTable(c.RouteTable, c.RedisAddr),
+		check(c.BearerTokensFile != "" || c.PasswordsFile != "", "bearer_tokens_file, passwords_file: at least one must be set"),
+		nonEmpty("access_policy_file", c.AccessPolicyFile),
+		nonEmpty("token", c.Token),
+		nonEmpty("host_template", c.HostTemplate),
+		validHostTemplate("host_template", c.HostTemplate),
+		check(c.RouteCacheTTL >= 0, "route_cache_ttl: must not be negative, got %s", c.RouteCacheTTL),
+		check(c.ExposerTLS || c.TLS.IsZero(), "tls: exposer_tls must be enabled when tls options are set"),
+		validTLS(c.TLS),
+		validLog(c.Log),
+	)
+}
+
+// EdgeServiceConfig cmd/edgeservice 的配置
+type EdgeServiceConfig struct {
+	ServiceID string `json:"service_id" yaml:"service_id" env:"EDGE_SERVICE_ID" flag:"service-id" usage:"服务 ID"`
+	Port      int    `json:"port" yaml:"port" env:"EDGE_SERVICE_PORT" flag:"port" usage:"监听端口"`
+
+	Log logging.Config `json:"log" yaml:"log"`
+}
+
+func DefaultEdgeServiceConfig(serviceID string, port int) EdgeServiceConfig {
+	return EdgeServiceConfig{ServiceID: serviceID, Port: port, Log: defaultLogConfig()}
+}
+
+func (c *EdgeServiceConfig) Validate() error {
+	return errors.Join(
+		nonEmpty("service_id", c.ServiceID),
+		validPort("port", c.Port),
+		validLog(c.Log),
+	)
+}
+
+func defaultLogConfig() logging.Config {
+	return logging.Config{Level: demo.DemoLogLevel, Format: demo.DemoLogFormat}
+}
+
+func check(ok bool, format string, args ...interface{}) error {
+	if ok {
+		return nil
+	}
+	return fmt.Errorf(format, args...)
+}
+
+func nonEmpty(name, v string) error {
+	return check(v != "", "%s: must not be empty", name)
+}
+
+// validID 校验设备 ID、服务 ID 可以注册到路由表
+func validID(name, id string) error {
+	if err := routetable.ValidateID(id); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+func validPort(name string, port int) error {
+	return check(port > 0 && port <= 65535, "%s: must be in 1-65535, got %d", name, port)
+}
+
+func validHostPort(name, addr string) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("%s: want host:port, got %q", name, addr)
+	}
+	return nil
+}
+
+// validRouteTable route_table 为空时校验 redis_addr
+func validRouteTable(dsn, redisAddr string) error {
+	if dsn == "" {
+		return validHostPort("redis_addr", redisAddr)
+	}
+	if err := routetable.ValidateDSN(dsn); err != nil {
+		return fmt.Errorf("route_table: %w", err)
+	}
+	return nil
+}
+
+// OpenRouteTable 打开 route_table 指定的路由表，为空时使用 redis_addr 指定的 redis
+func OpenRouteTable(dsn, redisAddr string) (routetable.RouteTable, error) {
+	if dsn == "" {
+		return routetable.NewRedisRouteTable(redisAddr), nil
+	}
+	return routetable.Open(dsn)
+}
+
+func validOptionalHostPort(name, addr string) error {
+	if addr == "" {
+		return nil
+	}
+	return validHostPort(name, addr)
+}
+
+func validWSURL(name, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+		return fmt.Errorf("%s: want ws://host:port or wss://host:port, got %q", name, raw)
+	}
+	return nil
+}
+
+func validHostTemplate(name, template string) error {
+	if template == "" {
+		return nil
+	}
+	if _, err := protoconv.NewHostRouteResolver(template); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+func validPathTemplate(name, template string) error {
+	if template == "" {
+		return nil
+	}
+	if _, err := protoconv.NewPathRouteResolver(template); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// validTLS 校验 tls 配置，会读取证书文件
+func validTLS(cfg interface{ Validate() error }) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	return nil
+}
+
+func validReconnect(cfg ReconnectConfig) error {
+	if err := cfg.Policy().Validate(); err != nil {
+		return fmt.Errorf("reconnect: %w", err)
+	}
+	return nil
+}
+
+func validLog(cfg logging.Config) error {
+	if _, err := logging.New(cfg, io.Discard); err != nil {
+		return fmt.Errorf("log: %w", err)
+	}
+	return nil
+}
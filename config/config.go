@@ -0,0 +1,280 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 配置的优先级从低到高：默认值 < 配置文件 < 环境变量 < 命令行参数。
+//
+// 配置结构体的字段通过 tag 声明环境变量和命令行参数：
+//
+//	RedisAddr string `json:"redis_addr" yaml:"redis_addr" env:"EDGE_REDIS_ADDR" flag:"redis-addr" usage:"redis 地址"`
+//
+// 支持的字段类型：string、bool、整数、浮点数、[]string（逗号分隔）和实现了 encoding.TextUnmarshaler 的类型，
+// 嵌套的结构体会递归处理。
+
+// ConfigFileEnvKey 未通过 -config 指定配置文件时，从该环境变量读取配置文件路径
+const ConfigFileEnvKey = "EDGE_CONFIG"
+
+// Validator 配置加载完成后调用 Validate 校验
+type Validator interface {
+	Validate() error
+}
+
+// Load 按优先级加载配置到 cfg，cfg 需要预先填充默认值。返回使用的配置文件路径（可能为空）。
+func Load(name string, args []string, cfg Validator) (path string, err error) {
+	fields, err := collectFields(cfg)
+	if err != nil {
+		return "", err
+	}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&path, "config", os.Getenv(ConfigFileEnvKey), "配置文件路径 (.yaml/.yml/.json)，也可以通过环境变量 "+ConfigFileEnvKey+" 指定")
+	var pending []pendingFlag
+	for _, f := range fields {
+		if f.flag == "" {
+			continue
+		}
+		fs.Var(&flagValue{field: f, pending: &pending}, f.flag, f.usageText())
+	}
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() > 0 {
+		return "", fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	if path != "" {
+		if err := LoadFile(path, cfg); err != nil {
+			return "", err
+		}
+	}
+	for _, f := range fields {
+		if f.env == "" {
+			continue
+		}
+		if raw, ok := os.LookupEnv(f.env); ok {
+			if err := setValue(f.value, raw); err != nil {
+				return "", fmt.Errorf("env %s: %w", f.env, err)
+			}
+		}
+	}
+	for _, p := range pending {
+		if err := setValue(p.field.value, p.raw); err != nil {
+			return "", fmt.Errorf("flag -%s: %w", p.field.flag, err)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return "", fmt.Errorf("invalid config: %w", err)
+	}
+	return path, nil
+}
+
+// MustLoad 使用进程参数加载配置，出错时打印错误并退出进程
+func MustLoad(name string, cfg Validator) (path string) {
+	path, err := Load(name, os.Args[1:], cfg)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err.Error())
+		os.Exit(2)
+	}
+	return path
+}
+
+// LoadFile 根据扩展名解析 yaml 或 json 配置文件到 cfg，未知字段视为错误
+func LoadFile(path string, cfg interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		// 空文件返回 io.EOF，视为没有配置
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("parse config file %s: %w", path, err)
+		}
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(cfg); err != nil {
+			return fmt.Errorf("parse config file %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("config file %s: unknown extension, want .yaml, .yml or .json", path)
+	}
+	return nil
+}
+
+type field struct {
+	value reflect.Value
+	env   string
+	flag  string
+	usage string
+}
+
+func (f *field) usageText() string {
+	if f.env == "" {
+		return f.usage
+	}
+	return fmt.Sprintf("%s (环境变量 %s)", f.usage, f.env)
+}
+
+type pendingFlag struct {
+	field *field
+	raw   string
+}
+
+// flagValue 命令行参数先记录下来，等配置文件和环境变量处理完再生效
+type flagValue struct {
+	field   *field
+	pending *[]pendingFlag
+}
+
+func (v *flagValue) String() string {
+	if v == nil || v.field == nil {
+		return ""
+	}
+	return formatValue(v.field.value)
+}
+
+func (v *flagValue) Set(raw string) error {
+	// 提前校验格式，错误信息由 flag 包输出
+	if err := setValue(reflect.New(v.field.value.Type()).Elem(), raw); err != nil {
+		return err
+	}
+	*v.pending = append(*v.pending, pendingFlag{field: v.field, raw: raw})
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	return v.field.value.Kind() == reflect.Bool
+}
+
+func collectFields(cfg interface{}) ([]*field, error) {
+	rv := reflect.ValueOf(cfg)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config must be a pointer to struct, got %T", cfg)
+	}
+	var fields []*field
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			fv := v.Field(i)
+			env, flg := sf.Tag.Get("env"), sf.Tag.Get("flag")
+			if env == "" && flg == "" {
+				if fv.Kind() == reflect.Struct {
+					walk(fv)
+				}
+				continue
+			}
+			fields = append(fields, &field{value: fv, env: env, flag: flg, usage: sf.Tag.Get("usage")})
+		}
+	}
+	walk(rv.Elem())
+	return fields, nil
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+func setValue(v reflect.Value, raw string) error {
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		var items []string
+		for _, s := range strings.Split(raw, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				items = append(items, s)
+			}
+		}
+		v.Set(reflect.ValueOf(items).Convert(v.Type()))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func formatValue(v reflect.Value) string {
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+	if v.Kind() == reflect.Slice {
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// Duration 支持在配置文件、环境变量和命令行中使用 "30s"、"1m" 这样的写法
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
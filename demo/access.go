@@ -0,0 +1,50 @@
+package demo
+
+import (
+	"github.com/rectcircle/expose-edge-service-demo/auth"
+	"github.com/rectcircle/expose-edge-service-demo/policy"
+)
+
+// NewAccessAuthorizer 使用 bearer token 文件、api key 文件和访问策略文件构造 access 流程的鉴权，apiKeysFile 为空时不支持 api key。
+// 演示的文件参见 DemoBearerTokensFile、DemoAPIKeysFile 和 DemoAccessPolicyFile
+func NewAccessAuthorizer(bearerTokensFile, apiKeysFile, accessPolicyFile string) (policy.Authorizer, error) {
+	tokens, err := auth.LoadBearerTokensFile(bearerTokensFile)
+	if err != nil {
+		return nil, err
+	}
+	resolver := auth.ChainResolver{auth.ClientCertResolver{}, tokens}
+	if apiKeysFile != "" {
+		apiKeys, err := auth.LoadAPIKeysFile(apiKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		resolver = append(resolver, apiKeys)
+	}
+	p, err := policy.LoadFile(accessPolicyFile)
+	if err != nil {
+		return nil, err
+	}
+	return policy.NewEngine(resolver, p), nil
+}
+
+// NewProxyAuthorizer 使用 Proxy-Authorization 认证调用方的 http 代理鉴权，
+// bearerTokensFile 和 passwordsFile 为空时分别不支持 Bearer 和 Basic
+func NewProxyAuthorizer(bearerTokensFile, passwordsFile, accessPolicyFile string) (policy.Authorizer, error) {
+	resolver := &auth.ProxyAuthorizationResolver{}
+	var err error
+	if bearerTokensFile != "" {
+		if resolver.Tokens, err = auth.LoadBearerTokensFile(bearerTokensFile); err != nil {
+			return nil, err
+		}
+	}
+	if passwordsFile != "" {
+		if resolver.Passwords, err = auth.LoadPasswordsFile(passwordsFile); err != nil {
+			return nil, err
+		}
+	}
+	p, err := policy.LoadFile(accessPolicyFile)
+	if err != nil {
+		return nil, err
+	}
+	return policy.NewEngine(resolver, p), nil
+}
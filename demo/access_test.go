@@ -0,0 +1,37 @@
+package demo
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rectcircle/expose-edge-service-demo/auth"
+)
+
+// 使用仓库中的演示文件，路径相对于 demo 目录
+func TestNewAccessAuthorizerAPIKey(t *testing.T) {
+	authorizer, err := NewAccessAuthorizer("tokens.txt", "api-keys.txt", "policy.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRequest := func(apiKey string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(auth.APIKeyHeaderKey, apiKey)
+		return r
+	}
+	want := auth.Identity{Name: "demo-user", Method: auth.IdentityMethodAPIKey}
+
+	identity, err := authorizer.Authorize(newRequest("demo-api-key"), DemoEdgeDeviceID, DemoEdgeService1ID)
+	if err != nil || identity != want {
+		t.Fatalf("Authorize = %v, %v; want %v, nil", identity, err, want)
+	}
+	// 策略只允许 demo-user 访问 demo* 服务
+	identity, err = authorizer.Authorize(newRequest("demo-api-key"), DemoEdgeDeviceID, "ssh")
+	if identity != want || !errors.Is(err, auth.ErrForbidden) {
+		t.Fatalf("Authorize denied service = %v, %v; want %v, ErrForbidden", identity, err, want)
+	}
+	if _, err := authorizer.Authorize(newRequest("wrong-api-key"), DemoEdgeDeviceID, DemoEdgeService1ID); !errors.Is(err, auth.ErrUnauthenticated) {
+		t.Fatalf("Authorize with wrong api key error = %v, want ErrUnauthenticated", err)
+	}
+}
@@ -5,17 +5,56 @@ const (
 	DemoEdgeService1Port = 8081
 	DemoEdgeService2ID   = "demo2"
 	DemoEdgeService2Port = 8082
+	// demo3 是 udp echo 服务
+	DemoEdgeService3ID   = "demo3"
+	DemoEdgeService3Port = 8083
 
 	DemoEdgeDeviceID = "DEVICE-0000"
 
 	DemoRedisAddr = "localhost:6379"
 
+	// 设备密钥由该主密钥派生，参见 auth.DerivedSecretStore
+	DemoAuthMasterSecret = "demo-master-secret"
+
+	// access 流程的调用方凭证和访问策略，路径相对于仓库根目录
+	DemoBearerTokensFile = "demo/tokens.txt"
+	DemoAPIKeysFile      = "demo/api-keys.txt"
+	DemoAccessPolicyFile = "demo/policy.json"
+	DemoProtoConvToken   = "demo-protoconv-token"
+	DemoUserToken        = "demo-user-token"
+	// exposer server 管理接口的调用方凭证
+	DemoAdminTokensFile = "demo/admin-tokens.txt"
+	// SOCKS5、http CONNECT 等代理协议的调用方用户名密码
+	DemoPasswordsFile = "demo/passwords.txt"
+
 	ExposerServerURL  = "ws://localhost:8080"
 	ExposerServerPort = 8080
 
 	HTTPProtoConvPort = 9000
 
+	// /metrics 端口。exposer server 在自身端口上提供 /metrics
+	HTTPProtoConvMetricsPort    = 9100
+	TCPProtoConvMetricsPort     = 9101
+	ExposerClientMetricsPort    = 9102
+	UDPProtoConvMetricsPort     = 9103
+	SOCKS5ProtoConvMetricsPort  = 9104
+	ConnectProtoConvMetricsPort = 9105
+
+	// exposer client 本地控制接口的 unix socket，参见 edgectl
+	ExposerClientControlSocket = "/tmp/exposer-client.sock"
+
+	// 日志级别（debug、info、warn、error）和格式（text、json）
+	DemoLogLevel  = "info"
+	DemoLogFormat = "text"
+
 	TCPProtoConvPort      = 9001
 	TCPProtoConvServiceID = DemoEdgeService2ID
 	TCPProtoConvDeviceID  = DemoEdgeDeviceID
+
+	UDPProtoConvPort      = 9002
+	UDPProtoConvServiceID = DemoEdgeService3ID
+	UDPProtoConvDeviceID  = DemoEdgeDeviceID
+
+	SOCKS5ProtoConvPort  = 9003
+	ConnectProtoConvPort = 9004
 )
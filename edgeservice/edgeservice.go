@@ -2,17 +2,42 @@ package edgeservice
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+
+	"github.com/rectcircle/expose-edge-service-demo/logging"
 )
 
 func Run(serviceID string, port int) {
-	log.Printf("[edge service][service %s] start listening on port %d", serviceID, port)
+	l := slog.Default().With(logging.KeyComponent, "edge_service", logging.KeyServiceID, serviceID)
+	l.Info("start listening", "port", port)
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("[edge service] service id %s, port is %d: url=%s, header=%+v", serviceID, port, r.URL.String(), r.Header)
+		l.Info("request", "url", r.URL.String(), "header", r.Header)
 		w.Write([]byte(fmt.Sprintf("Hello, world! service id is %s,  port is %d", serviceID, port)))
 	})
 	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), nil); err != nil {
 		panic(err)
 	}
 }
+
+// RunUDPEcho udp echo 服务，原样返回收到的数据报
+func RunUDPEcho(serviceID string, port int) {
+	l := slog.Default().With(logging.KeyComponent, "edge_service", logging.KeyServiceID, serviceID)
+	pc, err := net.ListenPacket("udp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		panic(err)
+	}
+	l.Info("start listening udp", "port", port)
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			panic(err)
+		}
+		l.Info("datagram", "from", addr.String(), "size", n)
+		if _, err := pc.WriteTo(buf[:n], addr); err != nil {
+			l.Warn("write datagram error", logging.Err(err))
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package exposer
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/auth"
+	"github.com/rectcircle/expose-edge-service-demo/helper"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+)
+
+// exposer server 的管理接口，与 expose/access 流程使用同一个端口，需要 AdminResolver 认证：
+//   - GET    /admin/v1/sessions        本节点的设备会话 ([]AdminSession)，可以通过 ?device_id= 过滤
+//   - DELETE /admin/v1/sessions/<id>   强制断开会话，设备会按重连策略重新连接
+//   - GET    /admin/v1/cluster         根据路由表构建的集群视图 ([]ClusterNode)
+// 错误时返回 {"error": "..."}。
+
+const (
+	AdminAPIPrefix       = "/admin/"
+	AdminAPISessionsPath = "/admin/v1/sessions"
+	AdminAPIClusterPath  = "/admin/v1/cluster"
+)
+
+// AdminSession 本节点上一个设备会话的状态，设备的全部服务复用该会话
+type AdminSession struct {
+	SessionID      string    `json:"session_id"`
+	DeviceID       string    `json:"device_id"`
+	Generation     int64     `json:"generation"`
+	Services       []string  `json:"services"`
+	RemoteAddr     string    `json:"remote_addr"`
+	ConnectedSince time.Time `json:"connected_since"`
+	OpenStreams    int       `json:"open_streams"`
+	BytesToEdge    int64     `json:"bytes_to_edge"`
+	BytesFromEdge  int64     `json:"bytes_from_edge"`
+	RTTMillis      float64   `json:"rtt_ms,omitempty"` // 最近一次心跳的往返时间，还没有测量时为空
+	GoneAway       bool      `json:"gone_away,omitempty"`
+}
+
+// ClusterNode 路由表中一个 exposer server 节点及其持有的路由
+type ClusterNode struct {
+	Addr   string         `json:"addr"`
+	Local  bool           `json:"local"` // 是否为处理该请求的节点
+	Routes []ClusterRoute `json:"routes"`
+}
+
+type ClusterRoute struct {
+	DeviceID  string `json:"device_id"`
+	ServiceID string `json:"service_id"`
+}
+
+// AdminAPIError 管理接口的错误响应
+type AdminAPIError struct {
+	Error string `json:"error"`
+}
+
+// Sessions 返回本节点的设备会话，按设备 ID 排序，deviceID 不为空时只返回该设备的会话
+func (s *ExposerServer) Sessions(deviceID string) []AdminSession {
+	sessions := []AdminSession{}
+	s.myDeviceSessions.Range(func(key, _ interface{}) bool {
+		ds := key.(*deviceSession)
+		if deviceID != "" && ds.deviceID != deviceID {
+			return true
+		}
+		sessions = append(sessions, ds.adminSession())
+		return true
+	})
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].DeviceID != sessions[j].DeviceID {
+			return sessions[i].DeviceID < sessions[j].DeviceID
+		}
+		return sessions[i].ConnectedSince.Before(sessions[j].ConnectedSince)
+	})
+	return sessions
+}
+
+// Disconnect 强制断开本节点上的会话，会话不存在时返回 false
+func (s *ExposerServer) Disconnect(sessionID string) bool {
+	found := false
+	s.myDeviceSessions.Range(func(key, _ interface{}) bool {
+		ds := key.(*deviceSession)
+		if ds.sessionID != sessionID {
+			return true
+		}
+		found = true
+		ds.logger.Info("disconnect session by admin")
+		// expose 流程等待会话关闭后会清理会话表和路由表
+		_ = ds.session.Close()
+		return false
+	})
+	return found
+}
+
+// Cluster 根据路由表构建集群视图，按节点地址排序
+func (s *ExposerServer) Cluster() ([]ClusterNode, error) {
+	routes, err := s.globalRouteTable.List()
+	if err != nil {
+		return nil, err
+	}
+	byAddr := map[string]*ClusterNode{}
+	for _, route := range routes {
+		node, ok := byAddr[route.Addr]
+		if !ok {
+			node = &ClusterNode{Addr: route.Addr, Local: route.Addr == s.myIPPort()}
+			byAddr[route.Addr] = node
+		}
+		node.Routes = append(node.Routes, ClusterRoute{DeviceID: route.DeviceID, ServiceID: route.ServiceID})
+	}
+	nodes := make([]ClusterNode, 0, len(byAddr))
+	for _, node := range byAddr {
+		sort.Slice(node.Routes, func(i, j int) bool {
+			if node.Routes[i].DeviceID != node.Routes[j].DeviceID {
+				return node.Routes[i].DeviceID < node.Routes[j].DeviceID
+			}
+			return node.Routes[i].ServiceID < node.Routes[j].ServiceID
+		})
+		nodes = append(nodes, *node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Addr < nodes[j].Addr })
+	return nodes, nil
+}
+
+func (ds *deviceSession) adminSession() AdminSession {
+	ds.mu.Lock()
+	services := make([]string, 0, len(ds.services))
+	for edgeServiceID := range ds.services {
+		services = append(services, edgeServiceID)
+	}
+	goneAway := ds.goneAway
+	ds.mu.Unlock()
+	sort.Strings(services)
+	return AdminSession{
+		SessionID:      ds.sessionID,
+		DeviceID:       ds.deviceID,
+		Generation:     ds.generation,
+		Services:       services,
+		RemoteAddr:     ds.remoteAddr,
+		ConnectedSince: ds.since,
+		OpenStreams:    ds.session.NumStreams(),
+		BytesToEdge:    atomic.LoadInt64(&ds.bytesToEdge),
+		BytesFromEdge:  atomic.LoadInt64(&ds.bytesFromEdge),
+		RTTMillis:      float64(atomic.LoadInt64(&ds.rtt)) / float64(time.Millisecond),
+		GoneAway:       goneAway,
+	}
+}
+
+// ping 通过 yamux ping 测量会话的心跳往返时间
+func (ds *deviceSession) ping() {
+	rtt, err := ds.session.Ping()
+	if err != nil {
+		ds.logger.Debug("ping error", logging.Err(err))
+		return
+	}
+	atomic.StoreInt64(&ds.rtt, int64(rtt))
+}
+
+// adminAPIHandler 返回管理接口的 http.Handler，AdminResolver 为 nil 时总是返回 404
+func (s *ExposerServer) adminAPIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(AdminAPISessionsPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			helper.RespJSON(w, http.StatusMethodNotAllowed, AdminAPIError{Error: "method not allowed"})
+			return
+		}
+		helper.RespJSON(w, http.StatusOK, s.Sessions(r.URL.Query().Get("device_id")))
+	})
+	mux.HandleFunc(AdminAPISessionsPath+"/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			helper.RespJSON(w, http.StatusMethodNotAllowed, AdminAPIError{Error: "method not allowed"})
+			return
+		}
+		sessionID := strings.TrimPrefix(r.URL.Path, AdminAPISessionsPath+"/")
+		if !s.Disconnect(sessionID) {
+			helper.RespJSON(w, http.StatusNotFound, AdminAPIError{Error: "session not found"})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc(AdminAPIClusterPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			helper.RespJSON(w, http.StatusMethodNotAllowed, AdminAPIError{Error: "method not allowed"})
+			return
+		}
+		nodes, err := s.Cluster()
+		if err != nil {
+			helper.RespJSON(w, http.StatusBadGateway, AdminAPIError{Error: "list route table error: " + err.Error()})
+			return
+		}
+		helper.RespJSON(w, http.StatusOK, nodes)
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.AdminResolver == nil {
+			helper.RespJSON(w, http.StatusNotFound, AdminAPIError{Error: "admin api disabled"})
+			return
+		}
+		l := s.Logger.With(logging.KeyRemoteAddr, r.RemoteAddr)
+		identity, err := s.AdminResolver.Resolve(r)
+		if err != nil {
+			l.Warn("admin deny", "audit", true, "method", r.Method, "path", r.URL.Path, logging.Err(err))
+			helper.RespJSON(w, auth.StatusCode(err), AdminAPIError{Error: err.Error()})
+			return
+		}
+		if r.Method != http.MethodGet {
+			// 修改类操作记录审计日志
+			l.Info("admin request", "audit", true, "identity", identity.String(), "method", r.Method, "path", r.URL.Path)
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
@@ -1,35 +1,112 @@
 package exposer
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/gorilla/websocket"
 	"github.com/hashicorp/yamux"
+	"github.com/rectcircle/expose-edge-service-demo/auth"
 	"github.com/rectcircle/expose-edge-service-demo/helper"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+	"github.com/rectcircle/expose-edge-service-demo/metrics"
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
 )
 
 type ExposerClient struct {
 	DeviceID  string
 	ServerURL string
+	// TLSConfig 连接 wss:// 使用的 tls 配置（CA、客户端证书、证书固定），为 nil 时使用系统根证书
+	TLSConfig *tls.Config
+	// Signer 为 expose 请求签名，为 nil 时不携带凭证
+	Signer auth.Signer
+	// ReconnectPolicy 会话断开或连接失败后的重连策略，不合法时（参见 ReconnectPolicy.Validate）使用 DefaultReconnectPolicy 的间隔
+	ReconnectPolicy ReconnectPolicy
+	// AllowedCIDRs 服务的 tcp 目标地址允许的网段，默认只允许本机 (DefaultAllowedCIDRs)
+	AllowedCIDRs []netip.Prefix
+	// UDPIdleTimeout udp 服务的一个 flow（一个 access stream 对应一个本地 udp socket）空闲多久后关闭
+	UDPIdleTimeout time.Duration
+	Logger         *slog.Logger
 
-	wg           sync.WaitGroup
-	exposedFlags sync.Map // <service-id> => chan(struct{})
+	wg            sync.WaitGroup
+	exposedFlags  sync.Map // <service-id> => *exposedService
+	startOnce     sync.Once
+	closeOnce     sync.Once
+	wantCloseChan chan struct{}
+
+	controlMu sync.Mutex
+	session   *yamux.Session // 当前会话，未连接时为 nil
+	control   net.Conn       // 当前会话的控制流，未连接时为 nil
+
+	status connStatus
+	stats  streamCounters
+}
+
+// streamCounters access stream 的统计，跨会话累计
+type streamCounters struct {
+	active        int64
+	activeUDP     int64
+	total         int64
+	bytesToEdge   int64
+	bytesFromEdge int64
+}
+
+type exposedService struct {
+	ServiceID string
+	Target    Target
+	// Dynamic 通过控制接口暴露的服务，不受 Reload 影响
+	Dynamic bool
 }
 
+// ErrAlreadyExposed 服务已经暴露
+var ErrAlreadyExposed = errors.New("service already exposed")
+
+// ValidateServiceID 检查服务 ID：不能包含路由表的 key 分隔符 ':'（参见 routetable.ValidateID），
+// 也不能包含 '/'（控制接口按路径删除服务）
+func ValidateServiceID(id string) error {
+	if err := routetable.ValidateID(id); err != nil {
+		return err
+	}
+	if strings.Contains(id, "/") {
+		return fmt.Errorf("%w: %q must not contain '/'", routetable.ErrInvalidID, id)
+	}
+	return nil
+}
+
+// ErrSessionSuperseded 会话被同一设备更新的会话接管（收到原因为 GoAwayReasonSuperseded 的 go-away），
+// client 按 ReconnectPolicy.SupersededBackoff 长时间退避后再重连，不计入 MaxAttempts
+var ErrSessionSuperseded = errors.New("session superseded by a newer session of the same device")
+
+const (
+	// streamHeaderTimeout 读取 access stream header 的超时时间
+	streamHeaderTimeout = 10 * time.Second
+	// DefaultUDPIdleTimeout udp flow 默认的空闲超时时间
+	DefaultUDPIdleTimeout = time.Minute
+)
+
 func NewExposerClient(deviceID string, serviceURL string) *ExposerClient {
 	return &ExposerClient{
-		DeviceID:     deviceID,
-		ServerURL:    serviceURL,
-		wg:           sync.WaitGroup{},
-		exposedFlags: sync.Map{},
+		DeviceID:        deviceID,
+		ServerURL:       serviceURL,
+		ReconnectPolicy: DefaultReconnectPolicy(),
+		AllowedCIDRs:    DefaultAllowedCIDRs,
+		UDPIdleTimeout:  DefaultUDPIdleTimeout,
+		Logger:          slog.Default().With(logging.KeyComponent, metrics.ComponentExposerClient),
+		wg:              sync.WaitGroup{},
+		exposedFlags:    sync.Map{},
+		wantCloseChan:   make(chan struct{}),
 	}
 }
 
@@ -38,111 +115,391 @@ func (c *ExposerClient) WaitSignal() {
 		s := make(chan os.Signal, 1)
 		signal.Notify(s, syscall.SIGTERM, syscall.SIGINT)
 		sno := <-s
-		log.Printf("[exposer client][device %s] receive signal: %s", c.DeviceID, sno.String())
+		c.logger().Info("receive signal", "signal", sno.String())
 		c.exposedFlags.Range(func(key, _ interface{}) bool {
 			c.UnExpose(key.(string))
 			return true
 		})
+		c.Close()
 	}()
 	c.wg.Wait()
 }
 
+// Expose 暴露一个服务。设备的所有服务复用同一个到 exposer server 的会话，
+// 会话未建立时会建立会话，已建立时通过控制流通知 exposer server，不需要重连。
+// 服务 ID 不合法时只记录日志，参见 ValidateServiceID。
 func (c *ExposerClient) Expose(ServiceID string, ServiceLocalPort int) {
-	wantCloseChan := make(chan struct{})
-	if _, ok := c.exposedFlags.LoadOrStore(ServiceID, wantCloseChan); ok {
-		log.Printf("[exposer client][device %s, service %s] already exposed", c.DeviceID, ServiceID)
+	if err := ValidateServiceID(ServiceID); err != nil {
+		c.logger().Error("reject service", logging.KeyServiceID, ServiceID, logging.Err(err))
 		return
 	}
-	c.wg.Add(1)
+	c.expose(&exposedService{ServiceID: ServiceID, Target: LocalPortTarget(ServiceLocalPort)})
+}
+
+// ExposeTarget 暴露一个服务，服务的目标地址可以是本机或设备所在局域网的 tcp 地址、unix socket 等，参见 Target
+func (c *ExposerClient) ExposeTarget(ServiceID string, target Target) error {
+	if err := ValidateServiceID(ServiceID); err != nil {
+		return err
+	}
+	if err := c.checkTarget(target); err != nil {
+		return err
+	}
+	if !c.expose(&exposedService{ServiceID: ServiceID, Target: target}) {
+		return ErrAlreadyExposed
+	}
+	return nil
+}
+
+// expose 返回 false 表示服务已经暴露
+func (c *ExposerClient) expose(svc *exposedService) bool {
+	ServiceID := svc.ServiceID
+	if _, ok := c.exposedFlags.LoadOrStore(ServiceID, svc); ok {
+		c.logger().Warn("already exposed", logging.KeyServiceID, ServiceID)
+		return false
+	}
+	c.logger().Info("expose", logging.KeyServiceID, ServiceID, "target", svc.Target.String())
+	c.startOnce.Do(func() {
+		c.wg.Add(1)
+		go c.run()
+	})
+	c.advertise()
+	return true
+}
+
+func (c *ExposerClient) UnExpose(ServiceID string) {
+	c.unexpose(ServiceID)
+}
+
+// unexpose 返回 false 表示服务未暴露
+func (c *ExposerClient) unexpose(ServiceID string) bool {
+	if _, ok := c.exposedFlags.LoadAndDelete(ServiceID); !ok {
+		return false
+	}
+	c.logger().Info("unexpose", logging.KeyServiceID, ServiceID)
+	metrics.DeleteAccessSeries(metrics.ComponentExposerClient, c.DeviceID, ServiceID)
+	c.advertise()
+	return true
+}
+
+// Close 关闭到 exposer server 的会话，并停止重连
+func (c *ExposerClient) Close() {
+	c.closeOnce.Do(func() {
+		c.logger().Info("want to close")
+		close(c.wantCloseChan)
+	})
+}
+
+func (c *ExposerClient) logger() *slog.Logger {
+	return c.Logger.With(logging.KeyDeviceID, c.DeviceID)
+}
+
+func (c *ExposerClient) Wait() {
+	c.wg.Wait()
+}
+
+// Status 返回已暴露服务的状态，按 service id 排序
+func (c *ExposerClient) Status() []ServiceStatus {
+	state, since, attempts, lastError := c.status.get()
+	var statuses []ServiceStatus
+	c.exposedFlags.Range(func(_, value interface{}) bool {
+		svc := value.(*exposedService)
+		status := ServiceStatus{
+			ServiceID: svc.ServiceID,
+			Target:    svc.Target.String(),
+			Dynamic:   svc.Dynamic,
+			State:     state,
+			Since:     since,
+			Attempts:  attempts,
+		}
+		if lastError != nil {
+			status.LastError = lastError.Error()
+		}
+		statuses = append(statuses, status)
+		return true
+	})
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].ServiceID < statuses[j].ServiceID })
+	return statuses
+}
+
+// run 维护到 exposer server 的会话，断开后按 ReconnectPolicy 重连，直到 Close 或放弃重连
+func (c *ExposerClient) run() {
+	defer c.wg.Done()
+	// 不再重连后删除设备的时间序列，同一进程中可能依次运行多个设备 ID 的 client
+	defer metrics.ClientConnected.DeleteLabelValues(c.DeviceID)
+	defer metrics.DeleteAccessSeries(metrics.ComponentExposerClient, c.DeviceID, "")
+	policy := c.ReconnectPolicy
+	if err := policy.Validate(); err != nil {
+		c.logger().Error("invalid reconnect policy, use default intervals", logging.Err(err))
+		d := DefaultReconnectPolicy()
+		policy.InitialInterval, policy.MaxInterval, policy.Multiplier = d.InitialInterval, d.MaxInterval, d.Multiplier
+		if policy.MaxAttempts < 0 {
+			policy.MaxAttempts = 0
+		}
+	}
+	attempts := 0
+	var lastErr error
+	for {
+		select {
+		case <-c.wantCloseChan:
+			c.status.set(ConnStateClosed, attempts, lastErr)
+			c.logger().Info("close success")
+			return
+		default:
+		}
+		if attempts > 0 || lastErr != nil {
+			metrics.ClientReconnects.WithLabelValues(c.DeviceID).Inc()
+		}
+		c.status.set(ConnStateConnecting, attempts, lastErr)
+		established, err := c.connect()
+		if errors.Is(err, ErrSessionSuperseded) {
+			// 另一个使用相同设备 ID 的 client 建立了更新的会话，立即重连会和它互相接管。
+			// 按 MaxInterval 量级长时间退避后再重连（例如旧设备已经下线），不计入 MaxAttempts，也不放弃
+			lastErr = err
+			backoff := policy.SupersededBackoff()
+			c.logger().Error("session superseded by another client with the same device id", "backoff", backoff, logging.Err(err))
+			c.status.set(ConnStateBackingOff, attempts, lastErr)
+			select {
+			case <-c.wantCloseChan:
+			case <-time.After(backoff):
+				c.logger().Info("retry after superseded", "backoff", backoff)
+			}
+			continue
+		}
+		if established {
+			// 会话建立过，重新开始退避
+			attempts = 0
+		}
+		if err != nil {
+			attempts++
+			lastErr = err
+		}
+		if policy.MaxAttempts > 0 && attempts >= policy.MaxAttempts {
+			c.logger().Error("give up reconnecting", "attempts", attempts, logging.Err(lastErr))
+			c.status.set(ConnStateClosed, attempts, lastErr)
+			if policy.OnGiveUp != nil {
+				policy.OnGiveUp(c.DeviceID, attempts, lastErr)
+			}
+			return
+		}
+		// 即使是会话正常断开（例如 exposer server 重启）也需要随机退避，避免大量设备同时重连
+		backoff := policy.Backoff(attempts)
+		c.status.set(ConnStateBackingOff, attempts, lastErr)
+		select {
+		case <-c.wantCloseChan:
+		case <-time.After(backoff):
+			c.logger().Info("retry", "backoff", backoff, "attempts", attempts)
+		}
+	}
+}
+
+// connect 建立一次会话并处理 access stream，会话断开后返回。
+// established 表示会话是否建立成功过，err 为建立会话失败的原因。
+func (c *ExposerClient) connect() (established bool, err error) {
+	sl := c.logger().With(logging.KeySessionID, logging.NewSessionID())
+	l := sl.With(logging.KeyFlowType, EdgeFlowTypeExpose)
+	header, err := c.exposeHeader()
+	if err != nil {
+		l.Error("sign expose header error", logging.Err(err))
+		return false, err
+	}
+	// 打开 websocket 连接
+	wsConn, _, err := helper.WebsocketDialer(c.TLSConfig).Dial(c.ServerURL, header)
+	if err != nil {
+		l.Warn("connect to exposer server error", "server_url", c.ServerURL, logging.Err(err))
+		return false, err
+	}
+	l.Debug("connect to exposer server success", "server_url", c.ServerURL)
+	// 包装成 tcp 连接
+	conn := &helper.WebsocketConnWrapper{WsConn: wsConn}
+	// 构建 yamux server
+	session, err := yamux.Server(conn, yamuxConfig(sl))
+	if err != nil {
+		l.Error("make yamux server session error", logging.Err(err))
+		_ = conn.Close()
+		return false, err
+	}
+	l.Debug("make yamux server session success")
+	// 打开控制流，上报服务列表
+	control, err := session.Open()
+	if err != nil {
+		l.Warn("open control stream error", logging.Err(err))
+		_ = session.Close()
+		return false, err
+	}
+	l.Info("device session established", "server_url", c.ServerURL)
+	c.status.set(ConnStateConnected, 0, nil)
+	metrics.ClientConnected.WithLabelValues(c.DeviceID).Set(1)
+	defer metrics.ClientConnected.WithLabelValues(c.DeviceID).Set(0)
+	c.setControl(session, control)
+	defer c.setControl(nil, nil)
+	c.advertise()
+	// 获取是否需要关闭该 session
+	go func() {
+		select {
+		case <-session.CloseChan(): // 这个链接关闭了
+			l.Info("device session closed")
+		case <-c.wantCloseChan:
+			_ = session.Close()
+			l.Info("close device session")
+		}
+	}()
+	// 读取 server 发送的控制消息
+	goAwayChan := make(chan GoAwayReason, 1)
 	go func() {
-		defer c.wg.Done()
-		header := http.Header{}
-		header.Add(EdgeDeviceIDHeaderKey, c.DeviceID)
-		header.Add(EdgeServiceIDHeaderKey, ServiceID)
-		header.Add(EdgeFlowTypeHeaderKey, string(EdgeFlowTypeExpose))
-
-		for tryNumber := 0; ; tryNumber++ {
-			if tryNumber != 0 {
-				select {
-				case <-wantCloseChan:
-					log.Printf("[exposer client][device %s, service %s] close expose success", c.DeviceID, ServiceID)
-					return
-				case <-time.After(time.Second):
-					log.Printf("[exposer client][device %s, service %s] retry: %d ...", c.DeviceID, ServiceID, tryNumber)
-				}
+		for {
+			var msg controlMessage
+			if err := readFrame(control, &msg); err != nil {
+				return
 			}
-			// 打开 websocket 连接
-			wsConn, _, err := websocket.DefaultDialer.Dial(c.ServerURL, header)
-			if err != nil {
-				log.Printf("[exposer client][device %s, service %s] connect to exposer server %s error: %s", c.DeviceID, ServiceID, c.ServerURL, err.Error())
-				continue // 重试
+			if msg.Op == controlOpGoAway {
+				goAwayChan <- msg.Reason
+				return
 			}
-			log.Printf("[exposer client][device %s, service %s] try connect to exposer server %s success", c.DeviceID, ServiceID, c.ServerURL)
-			// 包装成 tcp 连接
-			conn := &helper.WebsocketConnWrapper{WsConn: wsConn}
-			// 构建 yamux server
-			session, err := yamux.Server(conn, nil)
+		}
+	}()
+	go func() {
+		for {
+			stream, err := session.Accept()
 			if err != nil {
-				log.Printf("[exposer client][device %s, service %s] make yamux server session error: %s", c.DeviceID, ServiceID, err.Error())
-				continue // 重试
-			}
-			log.Printf("[exposer client][device %s, service %s] make yamux server session success", c.DeviceID, ServiceID)
-			// 获取是否需要关闭该 session
-			go func() {
-				select {
-				case <-session.CloseChan(): // 这个链接关闭了
-					log.Printf("[exposer client][device %s, service %s] yamux server session has closed,", c.DeviceID, ServiceID)
-				case <-wantCloseChan:
-					_ = session.Close()
-					log.Printf("[exposer client][device %s, service %s] close yamux server session", c.DeviceID, ServiceID)
-				}
-			}()
-			for {
-				conn, err1 := session.Accept()
-				if err1 != nil {
-					log.Printf("[exposer client][device %s, service %s] session accept error: %s", c.DeviceID, ServiceID, err1.Error())
-					break
-				}
-				log.Printf("[exposer client][device %s, service %s] session accept success", c.DeviceID, ServiceID)
-				go c.proxy(conn, ServiceLocalPort)
+				l.Debug("session accept error", logging.Err(err))
+				return
 			}
+			go c.handleStream(sl, stream)
 		}
 	}()
+	var reason GoAwayReason
+	goneAway := false
+	select {
+	case <-session.CloseChan():
+		// server 发送 go-away 后可能很快关闭会话
+		select {
+		case reason = <-goAwayChan:
+			goneAway = true
+		default:
+		}
+	case reason = <-goAwayChan:
+		goneAway = true
+	}
+	if !goneAway {
+		return true, nil
+	}
+	// 旧会话上已经建立的 stream 继续工作，直到 server 关闭会话；同时重新连接建立新的会话
+	if reason == GoAwayReasonSuperseded {
+		// client 同时只有一个会话在处理 go-away，当前会话被接管说明有其他 client 使用了相同的设备 ID
+		l.Warn("receive go-away, session superseded by a newer session of the same device")
+		return true, ErrSessionSuperseded
+	}
+	l.Info("receive go-away, will reconnect", "reason", reason)
+	return true, nil
 }
 
-func (c *ExposerClient) UnExpose(ServiceID string) {
-	if wantCloseChanI, ok := c.exposedFlags.Load(ServiceID); ok {
-		log.Printf("[exposer client][device %s, service %s] want to close expose", c.DeviceID, ServiceID)
-		c.exposedFlags.Delete(ServiceID)
-		wantCloseChan := wantCloseChanI.(chan struct{})
-		close(wantCloseChan)
+// handleStream 读取 stream header，转发到对应的服务
+func (c *ExposerClient) handleStream(l *slog.Logger, stream net.Conn) {
+	l = l.With(logging.KeyFlowType, EdgeFlowTypeAccess)
+	var h streamHeader
+	_ = stream.SetReadDeadline(time.Now().Add(streamHeaderTimeout))
+	if err := readFrame(stream, &h); err != nil {
+		l.Warn("read stream header error", logging.Err(err))
+		metrics.AccessFailed(metrics.ComponentExposerClient, "stream_header")
+		_ = stream.Close()
+		return
+	}
+	_ = stream.SetReadDeadline(time.Time{})
+	l = l.With(logging.KeyServiceID, h.ServiceID)
+	svcI, ok := c.exposedFlags.Load(h.ServiceID)
+	if !ok {
+		l.Warn("service not exposed")
+		metrics.AccessFailed(metrics.ComponentExposerClient, "not_exposed")
+		_ = stream.Close()
 		return
 	}
+	c.proxy(l, stream, h.ServiceID, svcI.(*exposedService).Target)
 }
 
-func (c *ExposerClient) Wait() {
-	c.wg.Wait()
+func (c *ExposerClient) setControl(session *yamux.Session, control net.Conn) {
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+	c.session, c.control = session, control
+}
+
+// advertise 通过控制流上报当前暴露的全部服务，未连接时忽略（连接建立后会上报）
+func (c *ExposerClient) advertise() {
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+	if c.control == nil {
+		return
+	}
+	services := []string{}
+	c.exposedFlags.Range(func(key, _ interface{}) bool {
+		services = append(services, key.(string))
+		return true
+	})
+	if err := writeFrame(c.control, controlMessage{Op: controlOpServices, Services: services}); err != nil {
+		c.logger().Warn("advertise services error", logging.Err(err))
+		_ = c.control.Close()
+		return
+	}
+	c.logger().Info("advertise services success", "services", services)
+}
+
+// exposeHeader 构造 expose 请求的 header，签名带有时间戳，所以每次重连都需要重新生成
+func (c *ExposerClient) exposeHeader() (http.Header, error) {
+	header := http.Header{}
+	header.Add(EdgeDeviceIDHeaderKey, c.DeviceID)
+	header.Add(EdgeFlowTypeHeaderKey, string(EdgeFlowTypeExpose))
+	if c.Signer != nil {
+		if err := c.Signer.Sign(header, c.DeviceID, ""); err != nil {
+			return nil, err
+		}
+	}
+	return header, nil
 }
 
-func (c *ExposerClient) proxy(conn net.Conn, port int) {
+func (c *ExposerClient) proxy(l *slog.Logger, conn net.Conn, ServiceID string, target Target) {
 	defer conn.Close()
-	tcpAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("localhost:%d", port))
-	if err != nil {
-		log.Printf("[exposer client][proxy] parse localhost:%d error: %s", port, err.Error())
+	l = l.With("target", target.String())
+	nextConn, err := c.dialTarget(target)
+	if errors.Is(err, ErrTargetNotAllowed) {
+		l.Warn("target not allowed", logging.Err(err))
+		metrics.AccessFailed(metrics.ComponentExposerClient, "target_not_allowed")
 		return
 	}
-	log.Printf("[exposer client][proxy] parse localhost:%d success", port)
-	nextConn, err := net.DialTCP("tcp", nil, tcpAddr)
 	if err != nil {
-		log.Printf("[exposer client][proxy] open tcp connect to localhost:%d error: %s", port, err.Error())
+		l.Warn("connect to target error", logging.Err(err))
+		metrics.AccessFailed(metrics.ComponentExposerClient, "dial_target")
 		return
 	}
-	log.Printf("[exposer client][proxy] open tcp connect to localhost:%d success", port)
+	l.Debug("connect to target success")
+	metrics.AccessOpened(metrics.ComponentExposerClient, c.DeviceID, ServiceID)
+	atomic.AddInt64(&c.stats.total, 1)
+	atomic.AddInt64(&c.stats.active, 1)
+	defer atomic.AddInt64(&c.stats.active, -1)
 	defer nextConn.Close()
-	err = helper.IORelay(nextConn, conn)
+	toEdge := metrics.RelayCounter(metrics.ComponentExposerClient, metrics.DirectionToEdge)
+	fromEdge := metrics.RelayCounter(metrics.ComponentExposerClient, metrics.DirectionFromEdge)
+	countToEdge := func(n int) {
+		toEdge(n)
+		atomic.AddInt64(&c.stats.bytesToEdge, int64(n))
+	}
+	countFromEdge := func(n int) {
+		fromEdge(n)
+		atomic.AddInt64(&c.stats.bytesFromEdge, int64(n))
+	}
+	if target.Network == "udp" {
+		// 一个 access stream 是一个 udp flow，数据报分帧传输
+		atomic.AddInt64(&c.stats.activeUDP, 1)
+		defer atomic.AddInt64(&c.stats.activeUDP, -1)
+		err = helper.RelayDatagrams(conn, nextConn, c.UDPIdleTimeout, countToEdge, countFromEdge)
+		if errors.Is(err, helper.ErrIdleTimeout) {
+			l.Debug("udp flow idle timeout", "idle_timeout", c.UDPIdleTimeout)
+			return
+		}
+	} else {
+		err = helper.IORelayCounted(nextConn, conn, countToEdge, countFromEdge)
+	}
 	if err != nil {
-		log.Printf("[exposer client][proxy] ip copy error: %s", err.Error())
+		l.Debug("proxy IORelay error", logging.Err(err))
 		return
 	}
-	log.Printf("[exposer client][proxy] proxy finish")
+	l.Debug("proxy finish")
 }
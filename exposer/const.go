@@ -11,4 +11,11 @@ const (
 	EdgeFlowTypeHeaderKey  = "X-Edge-Flow-Type"
 	EdgeDeviceIDHeaderKey  = "X-Edge-Device-ID"
 	EdgeServiceIDHeaderKey = "X-Edge-Service-ID"
+	// EdgeHopCountHeaderKey access 请求已经在 exposer server 之间转发的次数，用于防止转发成环
+	EdgeHopCountHeaderKey = "X-Edge-Hop-Count"
+	// EdgeForwardedIdentityHeaderKey、EdgePeerTimestampHeaderKey、EdgePeerSignatureHeaderKey
+	// 转发节点已经鉴权的调用方身份及其签名，只有持有 PeerSecret 的节点可以生成，参见 ExposerServer.PeerSecret
+	EdgeForwardedIdentityHeaderKey = "X-Edge-Forwarded-Identity"
+	EdgePeerTimestampHeaderKey     = "X-Edge-Peer-Timestamp"
+	EdgePeerSignatureHeaderKey     = "X-Edge-Peer-Signature"
 )
@@ -0,0 +1,222 @@
+package exposer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/helper"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+)
+
+// 设备本地的控制接口，通过 unix domain socket 提供 HTTP API，设备上的应用可以在运行时暴露和取消暴露服务：
+//   - GET    /v1/services       已暴露的服务及状态 ([]ServiceStatus)
+//   - POST   /v1/services       暴露服务，body 为 ExposeRequest
+//   - DELETE /v1/services/<id>  取消暴露服务
+//   - GET    /v1/session        会话统计 (SessionStats)
+// 错误时返回 {"error": "..."}。
+
+const (
+	ControlAPIServicesPath = "/v1/services"
+	ControlAPISessionPath  = "/v1/session"
+)
+
+// ExposeRequest POST /v1/services 的 body
+type ExposeRequest struct {
+	ServiceID string `json:"service_id"`
+	Target    string `json:"target"` // 参见 Target
+}
+
+// ControlAPIError 控制接口的错误响应
+type ControlAPIError struct {
+	Error string `json:"error"`
+}
+
+// SessionStats 设备到 exposer server 的会话统计，stream 和字节数跨会话累计
+type SessionStats struct {
+	DeviceID      string    `json:"device_id"`
+	ServerURL     string    `json:"server_url"`
+	State         ConnState `json:"state"`
+	Since         time.Time `json:"since"`
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"last_error,omitempty"`
+	Services      int       `json:"services"`
+	ActiveStreams int64     `json:"active_streams"`
+	ActiveUDP     int64     `json:"active_udp_flows"`
+	TotalStreams  int64     `json:"total_streams"`
+	BytesToEdge   int64     `json:"bytes_to_edge"`
+	BytesFromEdge int64     `json:"bytes_from_edge"`
+	RTTMillis     float64   `json:"rtt_ms,omitempty"` // 会话的心跳往返时间，未连接时为空
+}
+
+// Stats 返回会话统计，已连接时会通过 yamux ping 测量往返时间
+func (c *ExposerClient) Stats() SessionStats {
+	state, since, attempts, lastError := c.status.get()
+	stats := SessionStats{
+		DeviceID:      c.DeviceID,
+		ServerURL:     c.ServerURL,
+		State:         state,
+		Since:         since,
+		Attempts:      attempts,
+		ActiveStreams: atomic.LoadInt64(&c.stats.active),
+		ActiveUDP:     atomic.LoadInt64(&c.stats.activeUDP),
+		TotalStreams:  atomic.LoadInt64(&c.stats.total),
+		BytesToEdge:   atomic.LoadInt64(&c.stats.bytesToEdge),
+		BytesFromEdge: atomic.LoadInt64(&c.stats.bytesFromEdge),
+	}
+	if lastError != nil {
+		stats.LastError = lastError.Error()
+	}
+	c.exposedFlags.Range(func(_, _ interface{}) bool {
+		stats.Services++
+		return true
+	})
+	c.controlMu.Lock()
+	session := c.session
+	c.controlMu.Unlock()
+	if session != nil {
+		if rtt, err := session.Ping(); err == nil {
+			stats.RTTMillis = float64(rtt) / float64(time.Millisecond)
+		}
+	}
+	return stats
+}
+
+// ControlAPIHandler 返回控制接口的 http.Handler
+func (c *ExposerClient) ControlAPIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(ControlAPIServicesPath, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			statuses := c.Status()
+			if statuses == nil {
+				statuses = []ServiceStatus{}
+			}
+			helper.RespJSON(w, http.StatusOK, statuses)
+		case http.MethodPost:
+			var req ExposeRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				helper.RespJSON(w, http.StatusBadRequest, ControlAPIError{Error: "bad request body: " + err.Error()})
+				return
+			}
+			if err := ValidateServiceID(req.ServiceID); err != nil {
+				helper.RespJSON(w, http.StatusBadRequest, ControlAPIError{Error: "bad service_id: " + err.Error()})
+				return
+			}
+			target, err := ParseTarget(req.Target)
+			if err != nil {
+				helper.RespJSON(w, http.StatusBadRequest, ControlAPIError{Error: err.Error()})
+				return
+			}
+			if err := c.checkTarget(target); err != nil {
+				helper.RespJSON(w, http.StatusForbidden, ControlAPIError{Error: err.Error()})
+				return
+			}
+			if !c.expose(&exposedService{ServiceID: req.ServiceID, Target: target, Dynamic: true}) {
+				helper.RespJSON(w, http.StatusConflict, ControlAPIError{Error: ErrAlreadyExposed.Error()})
+				return
+			}
+			helper.RespJSON(w, http.StatusCreated, ExposeRequest{ServiceID: req.ServiceID, Target: target.String()})
+		default:
+			helper.RespJSON(w, http.StatusMethodNotAllowed, ControlAPIError{Error: "method not allowed"})
+		}
+	})
+	mux.HandleFunc(ControlAPIServicesPath+"/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			helper.RespJSON(w, http.StatusMethodNotAllowed, ControlAPIError{Error: "method not allowed"})
+			return
+		}
+		serviceID := strings.TrimPrefix(r.URL.Path, ControlAPIServicesPath+"/")
+		if !c.unexpose(serviceID) {
+			helper.RespJSON(w, http.StatusNotFound, ControlAPIError{Error: "service not exposed"})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc(ControlAPISessionPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			helper.RespJSON(w, http.StatusMethodNotAllowed, ControlAPIError{Error: "method not allowed"})
+			return
+		}
+		helper.RespJSON(w, http.StatusOK, c.Stats())
+	})
+	return mux
+}
+
+// ServeControlAPI 在 unix domain socket socketPath 上提供控制接口，直到 Close。
+// 只有与 exposer client 同组的用户可以访问该 socket。
+func (c *ExposerClient) ServeControlAPI(socketPath string) error {
+	listen, err := listenUnixSocket(socketPath, 0o660)
+	if err != nil {
+		return err
+	}
+	c.logger().Info("control api listening", "socket", socketPath)
+	server := &http.Server{Handler: c.ControlAPIHandler()}
+	go func() {
+		<-c.wantCloseChan
+		_ = server.Close()
+		_ = os.Remove(socketPath)
+	}()
+	if err := server.Serve(listen); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		c.logger().Error("control api serve error", logging.Err(err))
+		return err
+	}
+	return nil
+}
+
+// listenUnixSocket 在 socketPath 上监听，socket 文件创建时就是 perm 权限：
+// 先在 socketPath 同目录下的 0700 临时目录中监听并修改权限，再 rename 到 socketPath，
+// 避免 Listen 和 Chmod 之间其他用户使用 umask 默认权限连接。
+// socketPath 是上次异常退出残留的 socket 文件时删除，仍有进程在监听时返回错误。
+func listenUnixSocket(socketPath string, perm fs.FileMode) (net.Listener, error) {
+	if err := removeStaleSocket(socketPath); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(filepath.Dir(socketPath), ".control-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmpPath := filepath.Join(dir, "sock")
+	listen, err := net.Listen("unix", tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	// rename 后由调用方删除 socketPath
+	listen.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		listen.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, socketPath); err != nil {
+		listen.Close()
+		return nil, err
+	}
+	return listen, nil
+}
+
+func removeStaleSocket(socketPath string) error {
+	info, err := os.Lstat(socketPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a unix socket", socketPath)
+	}
+	if conn, err := net.DialTimeout("unix", socketPath, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another process", socketPath)
+	}
+	return os.Remove(socketPath)
+}
@@ -0,0 +1,79 @@
+package exposer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
+)
+
+func TestListenUnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "control.sock")
+
+	// 上次异常退出残留的 socket 文件
+	stale, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listen, err := listenUnixSocket(socketPath, 0o660)
+	if err != nil {
+		t.Fatalf("listen with stale socket: %v", err)
+	}
+	defer listen.Close()
+	info, err := os.Lstat(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&fs.ModeSocket == 0 || info.Mode().Perm() != 0o660 {
+		t.Fatalf("socket mode = %s, want socket with 0660", info.Mode())
+	}
+	go func() {
+		conn, err := listen.Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+	// 仍有进程在监听时不能删除
+	if _, err := listenUnixSocket(socketPath, 0o660); err == nil {
+		t.Fatal("listen on socket in use want error")
+	}
+	// 临时目录已经删除
+	entries, _ := os.ReadDir(filepath.Dir(socketPath))
+	if len(entries) != 1 {
+		t.Fatalf("socket dir entries = %d, want 1", len(entries))
+	}
+}
+
+func TestExposeRejectsInvalidServiceID(t *testing.T) {
+	// 没有 exposer server，不合法的服务 ID 不会启动会话
+	c := NewExposerClient("DEVICE-0000", "ws://127.0.0.1:1")
+	defer c.Close()
+	handler := c.ControlAPIHandler()
+	for _, id := range []string{"", "demo:1", "demo/1", ":"} {
+		if err := c.ExposeTarget(id, LocalPortTarget(8081)); !errors.Is(err, routetable.ErrInvalidID) {
+			t.Errorf("ExposeTarget(%q) error = %v, want ErrInvalidID", id, err)
+		}
+		c.Expose(id, 8081)
+
+		body, _ := json.Marshal(ExposeRequest{ServiceID: id, Target: "127.0.0.1:8081"})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, ControlAPIServicesPath, bytes.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("POST service_id %q status = %d, want 400", id, w.Code)
+		}
+	}
+	if statuses := c.Status(); len(statuses) != 0 {
+		t.Fatalf("exposed services = %+v, want none", statuses)
+	}
+}
@@ -0,0 +1,85 @@
+package exposer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ControlClient 访问 exposer client 控制接口（参见 ServeControlAPI）的客户端
+type ControlClient struct {
+	httpClient *http.Client
+}
+
+func NewControlClient(socketPath string) *ControlClient {
+	return &ControlClient{
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+func (c *ControlClient) Services() ([]ServiceStatus, error) {
+	var statuses []ServiceStatus
+	err := c.do(http.MethodGet, ControlAPIServicesPath, nil, http.StatusOK, &statuses)
+	return statuses, err
+}
+
+func (c *ControlClient) Expose(serviceID, target string) error {
+	req := ExposeRequest{ServiceID: serviceID, Target: target}
+	return c.do(http.MethodPost, ControlAPIServicesPath, req, http.StatusCreated, nil)
+}
+
+func (c *ControlClient) UnExpose(serviceID string) error {
+	return c.do(http.MethodDelete, ControlAPIServicesPath+"/"+url.PathEscape(serviceID), nil, http.StatusNoContent, nil)
+}
+
+func (c *ControlClient) Stats() (SessionStats, error) {
+	var stats SessionStats
+	err := c.do(http.MethodGet, ControlAPISessionPath, nil, http.StatusOK, &stats)
+	return stats, err
+}
+
+func (c *ControlClient) do(method, path string, body interface{}, wantStatus int, out interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+	// host 部分不会被使用，连接总是发往 unix socket
+	req, err := http.NewRequest(method, "http://exposer-client"+path, &reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != wantStatus {
+		var apiErr ControlAPIError
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("%s %s: %s", method, path, apiErr.Error)
+		}
+		return fmt.Errorf("%s %s: unexpected status %s", method, path, resp.Status)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package exposer
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+)
+
+const (
+	// drainPollInterval Shutdown 检查 access 请求是否处理完成的间隔
+	drainPollInterval = 100 * time.Millisecond
+	// supersededCloseTimeout 被接管的会话等待已经建立的 stream 结束的最长时间
+	supersededCloseTimeout = 30 * time.Second
+)
+
+// Shutdown 优雅下线：
+//  1. 不再接受新的 expose 请求；
+//  2. 从路由表中删除本节点的路由；
+//  3. 向每个设备发送 go-away，设备会重新连接到其他节点；
+//  4. 等待正在处理的 access 请求结束，或 ctx 超时；
+//  5. 关闭所有会话和监听。
+//
+// ctx 超时后仍会强制关闭，并返回 ctx.Err()。
+func (s *ExposerServer) Shutdown(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&s.draining, 0, 1) {
+		return nil
+	}
+	s.Logger.Info("shutdown: start draining")
+	s.shutdownOnce.Do(func() { close(s.shutdownChan) })
+	s.myDeviceSessions.Range(func(key, _ interface{}) bool {
+		s.goAway(key.(*deviceSession), GoAwayReasonShutdown)
+		return true
+	})
+	err := s.waitAccessDrained(ctx)
+	if err != nil {
+		s.Logger.Warn("shutdown: wait access drained error", "inflight_access", atomic.LoadInt64(&s.inflightAccess), logging.Err(err))
+	} else {
+		s.Logger.Info("shutdown: all access drained")
+	}
+	s.myDeviceSessions.Range(func(key, _ interface{}) bool {
+		_ = key.(*deviceSession).session.Close()
+		return true
+	})
+	// 被 hijack 的 websocket 连接不受 http.Server 管理，上面已经关闭，这里只需要关闭监听
+	if closeErr := s.httpServer.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	s.Logger.Info("shutdown: finish")
+	return err
+}
+
+func (s *ExposerServer) isDraining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+// goAway 将设备会话从会话表和路由表中摘除，并通知设备重新连接，每个会话只发送一次。
+// 会话上已经建立的 stream 继续工作，新的 access 请求会被转发到设备重新连接的节点。
+// 被接管的会话在 stream 结束后关闭（shutdown 时由 Shutdown 关闭）。
+func (s *ExposerServer) goAway(ds *deviceSession, reason GoAwayReason) {
+	ds.mu.Lock()
+	if ds.goneAway {
+		ds.mu.Unlock()
+		return
+	}
+	ds.goneAway = true
+	ds.mu.Unlock()
+	s.updateServices(ds, nil)
+	if reason == GoAwayReasonSuperseded {
+		defer func() { go s.closeWhenIdle(ds) }()
+	}
+	ds.controlMu.Lock()
+	defer ds.controlMu.Unlock()
+	if err := writeFrame(ds.control, controlMessage{Op: controlOpGoAway, Reason: reason}); err != nil {
+		ds.logger.Warn("send go-away error", "reason", reason, logging.Err(err))
+		return
+	}
+	ds.logger.Info("send go-away success", "reason", reason)
+}
+
+// closeWhenIdle 会话上只剩控制流，或等待超过 supersededCloseTimeout 后关闭会话。
+// 至少等待一个 drainPollInterval，让设备先读到 go-away
+func (s *ExposerServer) closeWhenIdle(ds *deviceSession) {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	timeout := time.After(supersededCloseTimeout)
+	for {
+		select {
+		case <-ds.session.CloseChan():
+			return
+		case <-timeout:
+			ds.logger.Info("superseded session still has streams, close it", "streams", ds.session.NumStreams())
+			_ = ds.session.Close()
+			return
+		case <-ticker.C:
+		}
+		if ds.session.NumStreams() <= 1 {
+			_ = ds.session.Close()
+			return
+		}
+	}
+}
+
+func (s *ExposerServer) waitAccessDrained(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for atomic.LoadInt64(&s.inflightAccess) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package exposer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/auth"
+	"github.com/rectcircle/expose-edge-service-demo/helper"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+	"github.com/rectcircle/expose-edge-service-demo/metrics"
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
+)
+
+// defaultMaxForwardHops 正常情况下只需要一跳：任意节点 -> 持有会话的节点
+const defaultMaxForwardHops = 1
+
+// websocket 握手相关的 header 由 Dialer 重新生成，不能透传
+var hopByHopHeaders = []string{
+	"Connection",
+	"Upgrade",
+	"Sec-Websocket-Key",
+	"Sec-Websocket-Version",
+	"Sec-Websocket-Extensions",
+	"Sec-Websocket-Protocol",
+}
+
+// peerMaxClockSkew 转发请求签名的时间戳与目标节点时间允许的最大偏差
+const peerMaxClockSkew = 30 * time.Second
+
+// parseHopCount 解析 X-Edge-Hop-Count，不存在时为 0
+func parseHopCount(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	hops, err := strconv.Atoi(value)
+	if err != nil || hops < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer, got %q", EdgeHopCountHeaderKey, value)
+	}
+	return hops, nil
+}
+
+// verifyPeer 校验转发节点的签名，返回转发节点已经鉴权的调用方身份。
+// 没有配置 PeerSecret 或请求没有签名时 fromPeer 为 false，由本节点鉴权
+func (s *ExposerServer) verifyPeer(r *http.Request, edgeDeviceID, edgeServiceID string) (identity auth.Identity, fromPeer bool, err error) {
+	signature := r.Header.Get(EdgePeerSignatureHeaderKey)
+	if s.PeerSecret == nil || signature == "" {
+		return auth.Identity{}, false, nil
+	}
+	timestamp := r.Header.Get(EdgePeerTimestampHeaderKey)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return auth.Identity{}, false, fmt.Errorf("%w: bad %s header", auth.ErrUnauthenticated, EdgePeerTimestampHeaderKey)
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return auth.Identity{}, false, fmt.Errorf("%w: bad %s header", auth.ErrUnauthenticated, EdgePeerSignatureHeaderKey)
+	}
+	if skew := time.Since(time.Unix(unix, 0)); skew > peerMaxClockSkew || skew < -peerMaxClockSkew {
+		return auth.Identity{}, false, fmt.Errorf("%w: peer timestamp out of range", auth.ErrForbidden)
+	}
+	forwardedIdentity := r.Header.Get(EdgeForwardedIdentityHeaderKey)
+	want := signPeer(s.PeerSecret, edgeDeviceID, edgeServiceID, r.Header.Get(EdgeHopCountHeaderKey), forwardedIdentity, timestamp)
+	if !hmac.Equal(got, want) {
+		return auth.Identity{}, false, fmt.Errorf("%w: peer signature mismatch", auth.ErrForbidden)
+	}
+	return auth.ParseIdentity(forwardedIdentity), true, nil
+}
+
+// signPeer 转发请求的签名内容: "forward\n<device-id>\n<service-id>\n<hops>\n<identity>\n<timestamp>"
+func signPeer(secret []byte, edgeDeviceID, edgeServiceID, hops, identity, timestamp string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("forward\n" + edgeDeviceID + "\n" + edgeServiceID + "\n" + hops + "\n" + identity + "\n" + timestamp))
+	return mac.Sum(nil)
+}
+
+// forward 将 access 请求透明地转发到路由表中持有该会话的 exposer server。
+// 调用方只需要连接任意一个 exposer server 即可（例如通过普通的负载均衡）。
+// identity 为本节点（或上一跳）已经鉴权的调用方身份，hops 为请求已经转发的次数。
+func (s *ExposerServer) forward(w http.ResponseWriter, r *http.Request, l *slog.Logger, identity auth.Identity, hops int, edgeDeviceID, edgeServiceID string) {
+	if hops >= s.MaxForwardHops {
+		l.Warn("forward hop limit exceeded", "max_hops", s.MaxForwardHops)
+		metrics.AccessFailed(metrics.ComponentExposerServer, "hop_limit")
+		helper.RespString(w, http.StatusLoopDetected, "loop detected: forward hop limit exceeded")
+		return
+	}
+	route, err := s.globalRouteTable.Lookup(edgeServiceID, edgeDeviceID)
+	if err == routetable.ErrNotFound {
+		l.Info("route table not found")
+		metrics.AccessFailed(metrics.ComponentExposerServer, "route_not_found")
+		helper.RespString(w, 502, "bad gateway: route table not found")
+		return
+	}
+	if err != nil {
+		l.Error("query route table error", logging.Err(err))
+		metrics.AccessFailed(metrics.ComponentExposerServer, "route_table")
+		helper.RespString(w, 502, "bad gateway: "+err.Error())
+		return
+	}
+	if route.Addr == s.myIPPort() {
+		// 路由表指向自己，但本地没有会话：会话刚断开，路由表还没有清理
+		l.Info("route table points to this node but session not found")
+		metrics.AccessFailed(metrics.ComponentExposerServer, "session_not_found")
+		helper.RespString(w, 502, "bad gateway: session not found")
+		return
+	}
+	// 连接持有会话的节点
+	header := r.Header.Clone()
+	for _, k := range hopByHopHeaders {
+		header.Del(k)
+	}
+	header.Set(EdgeHopCountHeaderKey, strconv.Itoa(hops+1))
+	// 调用方不能携带 peer 签名，只有本节点持有 PeerSecret 时才重新签名
+	header.Del(EdgeForwardedIdentityHeaderKey)
+	header.Del(EdgePeerTimestampHeaderKey)
+	header.Del(EdgePeerSignatureHeaderKey)
+	if s.PeerSecret != nil {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		header.Set(EdgeForwardedIdentityHeaderKey, identity.String())
+		header.Set(EdgePeerTimestampHeaderKey, timestamp)
+		header.Set(EdgePeerSignatureHeaderKey, hex.EncodeToString(signPeer(s.PeerSecret, edgeDeviceID, edgeServiceID,
+			header.Get(EdgeHopCountHeaderKey), identity.String(), timestamp)))
+	}
+	// 集群内的节点使用相同的监听方式
+	peerURL := "ws://" + route.Addr
+	if s.TLSConfig != nil {
+		peerURL = "wss://" + route.Addr
+	}
+	l = l.With("peer", route.Addr)
+	peerWsConn, resp, err := helper.WebsocketDialer(s.PeerTLSConfig).Dial(peerURL, header)
+	if err != nil {
+		l.Warn("forward connect error", logging.Err(err))
+		metrics.AccessFailed(metrics.ComponentExposerServer, "forward_dial")
+		if resp != nil {
+			// 透传对端的错误状态码，例如鉴权失败
+			helper.RespString(w, resp.StatusCode, fmt.Sprintf("forward to %s error: %s", route.Addr, resp.Status))
+		} else {
+			helper.RespString(w, 502, "bad gateway: "+err.Error())
+		}
+		return
+	}
+	l.Debug("forward connect success")
+	peerConn := &helper.WebsocketConnWrapper{WsConn: peerWsConn}
+	defer peerConn.Close()
+	wsConn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		l.Warn("forward websocket upgrade error", logging.Err(err))
+		metrics.AccessFailed(metrics.ComponentExposerServer, "upgrade")
+		return
+	}
+	wsConnWrapper := &helper.WebsocketConnWrapper{WsConn: wsConn}
+	defer wsConnWrapper.Close()
+	metrics.AccessOpened(metrics.ComponentExposerServer, edgeDeviceID, edgeServiceID)
+	err = helper.IORelayCounted(peerConn, wsConnWrapper,
+		metrics.RelayCounter(metrics.ComponentExposerServer, metrics.DirectionToEdge),
+		metrics.RelayCounter(metrics.ComponentExposerServer, metrics.DirectionFromEdge))
+	if err != nil {
+		l.Debug("forward IORelay error", logging.Err(err))
+	}
+	l.Debug("forward finish")
+}
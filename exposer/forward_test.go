@@ -0,0 +1,149 @@
+package exposer
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/auth"
+	"github.com/rectcircle/expose-edge-service-demo/helper"
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
+)
+
+// authorizerFunc 测试用的 policy.Authorizer
+type authorizerFunc func(r *http.Request, deviceID, serviceID string) (auth.Identity, error)
+
+func (f authorizerFunc) Authorize(r *http.Request, deviceID, serviceID string) (auth.Identity, error) {
+	return f(r, deviceID, serviceID)
+}
+
+// startEchoServer 模拟设备上的服务
+func startEchoServer(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// dialAccess 通过 exposer server 的 access 流程访问设备的服务，返回 http 状态码
+func dialAccess(t *testing.T, s *ExposerServer, deviceID, serviceID string, header http.Header) int {
+	t.Helper()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set(EdgeFlowTypeHeaderKey, string(EdgeFlowTypeAccess))
+	header.Set(EdgeDeviceIDHeaderKey, deviceID)
+	header.Set(EdgeServiceIDHeaderKey, serviceID)
+	wsConn, resp, err := helper.WebsocketDialer(nil).Dial("ws://"+s.myIPPort(), header)
+	if err != nil {
+		if resp == nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+	conn := &helper.WebsocketConnWrapper{WsConn: wsConn}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || !bytes.Equal(buf, []byte("ping")) {
+		t.Fatalf("echo through access stream = %q, %v", buf, err)
+	}
+	return resp.StatusCode
+}
+
+func TestForwardTrustsPeerIdentity(t *testing.T) {
+	const deviceID, serviceID = "DEVICE-0000", "echo"
+	// 调用方只能在直接连接的节点上鉴权（模拟不能随请求转发的 mTLS 客户端证书）
+	var peerAuthorizeCalls int64
+	allow := func(s *ExposerServer) {
+		s.AccessAuthorizer = authorizerFunc(func(r *http.Request, _, _ string) (auth.Identity, error) {
+			return auth.Identity{Name: "alice", Method: auth.IdentityMethodClientCert}, nil
+		})
+	}
+	deny := func(s *ExposerServer) {
+		s.AccessAuthorizer = authorizerFunc(func(r *http.Request, _, _ string) (auth.Identity, error) {
+			atomic.AddInt64(&peerAuthorizeCalls, 1)
+			return auth.Identity{}, auth.ErrNoCredential
+		})
+	}
+	start := func(t *testing.T, peerSecret []byte) (a, b *ExposerServer) {
+		rt := routetable.NewMemoryRouteTable()
+		withSecret := func(s *ExposerServer) { s.PeerSecret = peerSecret }
+		a = startTestServer(t, rt, allow, withSecret)
+		b = startTestServer(t, rt, deny, withSecret)
+		c := NewExposerClient(deviceID, "ws://"+b.myIPPort())
+		t.Cleanup(c.Close)
+		c.Expose(serviceID, startEchoServer(t))
+		waitFor(t, "route on server b", func() bool {
+			route, err := rt.Lookup(serviceID, deviceID)
+			return err == nil && route.Addr == b.myIPPort()
+		})
+		return a, b
+	}
+
+	t.Run("PeerSecret", func(t *testing.T) {
+		atomic.StoreInt64(&peerAuthorizeCalls, 0)
+		a, b := start(t, []byte("peer-secret"))
+		if code := dialAccess(t, a, deviceID, serviceID, nil); code != http.StatusSwitchingProtocols {
+			t.Fatalf("access through a = %d, want 101", code)
+		}
+		if n := atomic.LoadInt64(&peerAuthorizeCalls); n != 0 {
+			t.Fatalf("b authorized forwarded request %d times, want 0", n)
+		}
+		// 调用方设置的跳数不可信，按 0 处理
+		spoofedHops := http.Header{}
+		spoofedHops.Set(EdgeHopCountHeaderKey, "5")
+		if code := dialAccess(t, a, deviceID, serviceID, spoofedHops); code != http.StatusSwitchingProtocols {
+			t.Fatalf("access through a with spoofed hop count = %d, want 101", code)
+		}
+		// 调用方伪造的 peer 签名
+		forged := http.Header{}
+		forged.Set(EdgeForwardedIdentityHeaderKey, "mtls:alice")
+		forged.Set(EdgePeerTimestampHeaderKey, strconv.FormatInt(time.Now().Unix(), 10))
+		forged.Set(EdgePeerSignatureHeaderKey, "00")
+		if code := dialAccess(t, b, deviceID, serviceID, forged); code != http.StatusForbidden {
+			t.Fatalf("access with forged peer signature = %d, want 403", code)
+		}
+	})
+
+	t.Run("WithoutPeerSecret", func(t *testing.T) {
+		// 目标节点重新鉴权，不能随请求转发的身份被拒绝
+		a, _ := start(t, nil)
+		if code := dialAccess(t, a, deviceID, serviceID, nil); code != http.StatusUnauthorized {
+			t.Fatalf("access through a without peer secret = %d, want 401", code)
+		}
+	})
+}
+
+func TestAccessRejectsBadHopCount(t *testing.T) {
+	s := startTestServer(t, routetable.NewMemoryRouteTable())
+	for _, hops := range []string{"-100", "abc", "1.5"} {
+		header := http.Header{}
+		header.Set(EdgeHopCountHeaderKey, hops)
+		if code := dialAccess(t, s, "DEVICE-0000", "echo", header); code != http.StatusBadRequest {
+			t.Errorf("access with hop count %q = %d, want 400", hops, code)
+		}
+	}
+}
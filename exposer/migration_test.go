@@ -0,0 +1,205 @@
+package exposer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
+)
+
+// 两个 exposer server 共享同一个进程内路由表，模拟设备在节点之间迁移
+
+const testKeepaliveInterval = 100 * time.Millisecond
+
+// startTestServer 启动一个 exposer server，configure 在 Run 之前修改配置
+func startTestServer(t *testing.T, rt routetable.RouteTable, configure ...func(s *ExposerServer)) *ExposerServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	s, err := NewExposerServer(port, rt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.keepaliveInterval = testKeepaliveInterval
+	for _, fn := range configure {
+		fn(s)
+	}
+	go func() {
+		if err := s.Run(); err != nil {
+			t.Errorf("run exposer server: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = s.Shutdown(ctx)
+	})
+	waitFor(t, "exposer server listening", func() bool {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	})
+	return s
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestSessionMigrationBetweenServers(t *testing.T) {
+	rt := routetable.NewMemoryRouteTable()
+	a := startTestServer(t, rt)
+	b := startTestServer(t, rt)
+	const deviceID, serviceID = "DEVICE-0000", "demo1"
+	lookupAddr := func() string {
+		route, err := rt.Lookup(serviceID, deviceID)
+		if err != nil {
+			return ""
+		}
+		return route.Addr
+	}
+
+	gaveUp := make(chan error, 1)
+	c1 := NewExposerClient(deviceID, "ws://"+a.myIPPort())
+	c1.ReconnectPolicy.OnGiveUp = func(_ string, _ int, err error) { gaveUp <- err }
+	defer c1.Close()
+	c1.Expose(serviceID, 8081)
+	waitFor(t, "route on server a", func() bool { return lookupAddr() == a.myIPPort() })
+	routeA, _ := rt.Lookup(serviceID, deviceID)
+
+	// 使用相同设备 ID 的 client 连接到 b，会话代数更大，路由迁移到 b
+	c2 := NewExposerClient(deviceID, "ws://"+b.myIPPort())
+	defer c2.Close()
+	c2.Expose(serviceID, 8081)
+	waitFor(t, "route on server b", func() bool { return lookupAddr() == b.myIPPort() })
+	routeB, _ := rt.Lookup(serviceID, deviceID)
+	if !routeB.Supersedes(routeA) {
+		t.Fatalf("route on b %+v does not supersede route on a %+v", routeB, routeA)
+	}
+
+	// a 的 keepalive 发现路由已经被接管，c1 收到 go-away 后长时间退避，不放弃也不立即重连
+	waitFor(t, "superseded client backing off", func() bool {
+		state, _, _, lastErr := c1.status.get()
+		return state == ConnStateBackingOff && errors.Is(lastErr, ErrSessionSuperseded)
+	})
+	select {
+	case err := <-gaveUp:
+		t.Fatalf("superseded client gave up: %v", err)
+	default:
+	}
+
+	// a 关闭被接管的会话时不能删除 b 的路由，路由也不会再迁移回 a
+	waitFor(t, "superseded session removed from server a", func() bool {
+		n := 0
+		a.myDeviceSessions.Range(func(_, _ interface{}) bool { n++; return true })
+		return n == 0
+	})
+	time.Sleep(5 * testKeepaliveInterval)
+	route, err := rt.Lookup(serviceID, deviceID)
+	if err != nil || route != routeB {
+		t.Fatalf("route after migration = %+v, %v; want %+v", route, err, routeB)
+	}
+	if state, _, _, _ := c2.status.get(); state != ConnStateConnected {
+		t.Fatalf("client on server b state = %s, want connected", state)
+	}
+	if state, _, _, _ := c1.status.get(); state != ConnStateBackingOff {
+		t.Fatalf("superseded client state = %s, want backing-off", state)
+	}
+}
+
+func TestSupersededBackoff(t *testing.T) {
+	p := DefaultReconnectPolicy()
+	for i := 0; i < 100; i++ {
+		if backoff := p.SupersededBackoff(); backoff < p.MaxInterval/2 || backoff >= p.MaxInterval {
+			t.Fatalf("SupersededBackoff = %s, want in [%s, %s)", backoff, p.MaxInterval/2, p.MaxInterval)
+		}
+	}
+}
+
+// 设备与 a 的会话断开后重连到 b，a 迟到的清理（会话关闭后的 updateServices、keepalive 的删除和刷新）不能删除 b 的路由
+func TestLateTeardownKeepsNewerRoute(t *testing.T) {
+	rt := routetable.NewMemoryRouteTable()
+	a := startTestServer(t, rt)
+	b := startTestServer(t, rt)
+	const deviceID, serviceID = "DEVICE-0001", "demo1"
+
+	c1 := NewExposerClient(deviceID, "ws://"+a.myIPPort())
+	defer c1.Close()
+	c1.Expose(serviceID, 8081)
+	var dsA *deviceSession
+	waitFor(t, "route on server a", func() bool {
+		a.myDeviceSessions.Range(func(key, _ interface{}) bool { dsA = key.(*deviceSession); return false })
+		route, err := rt.Lookup(serviceID, deviceID)
+		return dsA != nil && err == nil && route.Addr == a.myIPPort()
+	})
+	routeA, _ := dsA.route(serviceID)
+
+	// 持有 dsA.mu，a 的清理在会话关闭后阻塞，直到设备在 b 上注册
+	dsA.mu.Lock()
+	c1.Close()
+	c1.Wait()
+	waitFor(t, "session on server a closed", func() bool { return dsA.session.IsClosed() })
+	c2 := NewExposerClient(deviceID, "ws://"+b.myIPPort())
+	defer c2.Close()
+	c2.Expose(serviceID, 8081)
+	var routeB routetable.Route
+	waitFor(t, "route on server b", func() bool {
+		route, err := rt.Lookup(serviceID, deviceID)
+		routeB = route
+		return err == nil && route.Addr == b.myIPPort()
+	})
+	// b 的 keepalive 会重新写入被删除的路由，通过事件检查 b 的路由从未被删除
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := rt.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dsA.mu.Unlock()
+
+	waitFor(t, "late teardown on server a", func() bool {
+		_, ok := dsA.route(serviceID)
+		return !ok
+	})
+	// 旧会话的路由已经不属于自己
+	if err := rt.Refresh(routeA, time.Minute); !errors.Is(err, routetable.ErrNotOwner) {
+		t.Fatalf("Refresh stale route error = %v, want ErrNotOwner", err)
+	}
+	if err := rt.Unregister(routeA); !errors.Is(err, routetable.ErrNotOwner) {
+		t.Fatalf("Unregister stale route error = %v, want ErrNotOwner", err)
+	}
+	if err := a.refreshRoute(dsA, serviceID); err != nil {
+		t.Fatalf("late refresh on server a error = %v", err)
+	}
+	time.Sleep(3 * testKeepaliveInterval)
+	route, err := rt.Lookup(serviceID, deviceID)
+	if err != nil || route != routeB {
+		t.Fatalf("route after late teardown = %+v, %v; want %+v", route, err, routeB)
+	}
+	for {
+		select {
+		case e := <-events:
+			if e.Type == routetable.EventTypeDelete && e.Route.DeviceID == deviceID {
+				t.Fatalf("route deleted after migration: %+v", e.Route)
+			}
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package exposer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+
+	"github.com/hashicorp/yamux"
+)
+
+// 设备与 exposer server 之间只有一个 websocket/yamux 会话，设备的全部服务复用该会话：
+//   - 会话建立后，设备打开第一个 yamux stream 作为控制流，通过 controlMessage 上报服务列表，
+//     服务增删时重新上报，不需要重连。
+//   - exposer server 下线前，或同一设备有更新的会话时，通过控制流发送带原因的 go-away，设备收到后建立新的会话。
+//   - exposer server 为每个 access 请求打开一个 yamux stream，先写入 streamHeader 指明目标服务，
+//     之后的数据原样转发到该服务。
+// 两种消息都使用 frame 编码：2 字节大端长度 + json。
+
+// yamuxConfig 会话的 yamux 配置，yamux 自身的日志（例如 `[ERR] yamux: Failed to read header`）输出到 l，
+// 而不是默认的 stderr
+func yamuxConfig(l *slog.Logger) *yamux.Config {
+	cfg := yamux.DefaultConfig()
+	cfg.LogOutput = nil
+	cfg.Logger = slog.NewLogLogger(l.Handler(), slog.LevelWarn)
+	return cfg
+}
+
+// maxFrameSize frame 的最大长度
+const maxFrameSize = math.MaxUint16
+
+// errFrameTooLarge 编码后的消息超过 maxFrameSize
+var errFrameTooLarge = errors.New("frame too large")
+
+type controlOp string
+
+const (
+	// controlOpServices 设备 -> server，全量上报设备当前暴露的服务列表
+	controlOpServices controlOp = "services"
+	// controlOpGoAway server -> 设备，server 即将下线，设备需要重新连接（负载均衡到其他节点），
+	// 当前会话上已经建立的 stream 不受影响，直到 server 关闭会话
+	controlOpGoAway controlOp = "goaway"
+)
+
+// GoAwayReason server 发送 go-away 的原因
+type GoAwayReason string
+
+const (
+	// GoAwayReasonShutdown server 即将下线，设备需要重新连接到其他节点。旧版本 server 发送的 go-away 没有原因，视为 shutdown
+	GoAwayReasonShutdown GoAwayReason = "shutdown"
+	// GoAwayReasonSuperseded 同一设备有更新的会话（例如设备已经重连，或多个设备使用了相同的设备 ID），
+	// 本会话的路由已经被更新的会话接管
+	GoAwayReasonSuperseded GoAwayReason = "superseded"
+)
+
+type controlMessage struct {
+	Op       controlOp    `json:"op"`
+	Services []string     `json:"services,omitempty"`
+	Reason   GoAwayReason `json:"reason,omitempty"` // 只用于 go-away
+}
+
+type streamHeader struct {
+	ServiceID string `json:"service_id"`
+}
+
+func writeFrame(w io.Writer, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(body) > maxFrameSize {
+		return errFrameTooLarge
+	}
+	buf := make([]byte, 2+len(body))
+	binary.BigEndian.PutUint16(buf, uint16(len(body)))
+	copy(buf[2:], body)
+	_, err = w.Write(buf)
+	return err
+}
+
+func readFrame(r io.Reader, v interface{}) error {
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return err
+	}
+	body := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,101 @@
+package exposer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	messages := []controlMessage{
+		{Op: controlOpServices, Services: []string{"demo1", "demo2"}},
+		{Op: controlOpServices}, // 删除全部服务
+		{Op: controlOpGoAway, Reason: GoAwayReasonSuperseded},
+	}
+	for _, m := range messages {
+		if err := writeFrame(&buf, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeFrame(&buf, streamHeader{ServiceID: "demo1"}); err != nil {
+		t.Fatal(err)
+	}
+	// 同一个 stream 上连续的 frame
+	for _, want := range messages {
+		var got controlMessage
+		if err := readFrame(&buf, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("readFrame = %+v, want %+v", got, want)
+		}
+	}
+	var h streamHeader
+	if err := readFrame(&buf, &h); err != nil || h.ServiceID != "demo1" {
+		t.Fatalf("readFrame stream header = %+v, %v", h, err)
+	}
+	if err := readFrame(&buf, &h); err != io.EOF {
+		t.Fatalf("readFrame at end error = %v, want EOF", err)
+	}
+}
+
+func TestFrameLegacyGoAway(t *testing.T) {
+	// 旧版本 server 发送的 go-away 没有原因
+	var buf bytes.Buffer
+	if err := writeFrame(&buf, map[string]string{"op": "goaway"}); err != nil {
+		t.Fatal(err)
+	}
+	var m controlMessage
+	if err := readFrame(&buf, &m); err != nil || m.Op != controlOpGoAway || m.Reason != "" {
+		t.Fatalf("readFrame legacy go-away = %+v, %v", m, err)
+	}
+}
+
+func TestFrameTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	// json 编码后加上引号和字段名超过 maxFrameSize
+	err := writeFrame(&buf, streamHeader{ServiceID: strings.Repeat("a", maxFrameSize)})
+	if !errors.Is(err, errFrameTooLarge) {
+		t.Fatalf("writeFrame oversize error = %v, want errFrameTooLarge", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("writeFrame oversize wrote %d bytes, want 0", buf.Len())
+	}
+	// 恰好 maxFrameSize
+	overhead := len(`{"service_id":""}`)
+	if err := writeFrame(&buf, streamHeader{ServiceID: strings.Repeat("a", maxFrameSize-overhead)}); err != nil {
+		t.Fatalf("writeFrame max size: %v", err)
+	}
+	var h streamHeader
+	if err := readFrame(&buf, &h); err != nil || len(h.ServiceID) != maxFrameSize-overhead {
+		t.Fatalf("readFrame max size = %d bytes, %v", len(h.ServiceID), err)
+	}
+}
+
+func TestReadFrameMalformed(t *testing.T) {
+	frame := func(body string, size int) []byte {
+		b := make([]byte, 2+len(body))
+		binary.BigEndian.PutUint16(b, uint16(size))
+		copy(b[2:], body)
+		return b
+	}
+	for name, tc := range map[string]struct {
+		data []byte
+		want error // nil 表示任意错误
+	}{
+		"ShortLength": {[]byte{0}, io.ErrUnexpectedEOF},
+		"ShortBody":   {frame(`{"op":"services"}`, 100), io.ErrUnexpectedEOF},
+		"BadJSON":     {frame(`{"op":`, 6), nil},
+	} {
+		var m controlMessage
+		err := readFrame(bytes.NewReader(tc.data), &m)
+		if err == nil || tc.want != nil && !errors.Is(err, tc.want) {
+			t.Errorf("%s: readFrame error = %v, want %v", name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package exposer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ReconnectPolicy exposer client 的重连策略：指数退避 + full jitter。
+// 第 n 次重连前等待 [0, min(MaxInterval, InitialInterval * Multiplier^n)) 内的随机时间，
+// 避免 exposer server 重启后大量设备同时重连。
+type ReconnectPolicy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	// MaxAttempts 连续失败多少次后放弃重连，放弃后 ExposerClient 进入 closed 状态，0 表示永不放弃
+	MaxAttempts int
+	// OnGiveUp 连续失败 MaxAttempts 次放弃重连时调用，可以为 nil。会话被接管（ErrSessionSuperseded）不会放弃重连
+	OnGiveUp func(deviceID string, attempts int, lastErr error)
+}
+
+func DefaultReconnectPolicy() ReconnectPolicy {
+	return ReconnectPolicy{
+		InitialInterval: time.Second,
+		MaxInterval:     time.Minute,
+		Multiplier:      2,
+	}
+}
+
+// Validate 校验重连策略，避免配置错误导致没有退避的紧密重连循环
+func (p ReconnectPolicy) Validate() error {
+	var errs []error
+	if p.InitialInterval <= 0 {
+		errs = append(errs, fmt.Errorf("initial interval must be positive, got %s", p.InitialInterval))
+	}
+	if p.MaxInterval < p.InitialInterval {
+		errs = append(errs, fmt.Errorf("max interval %s must not be less than initial interval %s", p.MaxInterval, p.InitialInterval))
+	}
+	if !(p.Multiplier >= 1) {
+		errs = append(errs, fmt.Errorf("multiplier must be at least 1, got %v", p.Multiplier))
+	}
+	if p.MaxAttempts < 0 {
+		errs = append(errs, fmt.Errorf("max attempts must not be negative, got %d", p.MaxAttempts))
+	}
+	return errors.Join(errs...)
+}
+
+var (
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// Backoff 返回第 attempt 次（从 0 开始）重连前需要等待的时间
+func (p ReconnectPolicy) Backoff(attempt int) time.Duration {
+	ceil := float64(p.InitialInterval) * math.Pow(p.Multiplier, float64(attempt))
+	if ceil > float64(p.MaxInterval) || math.IsInf(ceil, 0) || math.IsNaN(ceil) {
+		ceil = float64(p.MaxInterval)
+	}
+	if ceil < 1 {
+		return 0
+	}
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return time.Duration(jitterRand.Int63n(int64(ceil)))
+}
+
+// SupersededBackoff 返回会话被接管后重连前需要等待的时间：[MaxInterval/2, MaxInterval) 内的随机时间，
+// 使用相同设备 ID 的两个 client 不会频繁地互相接管
+func (p ReconnectPolicy) SupersededBackoff() time.Duration {
+	half := int64(p.MaxInterval / 2)
+	if half < 1 {
+		return p.MaxInterval
+	}
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return time.Duration(half + jitterRand.Int63n(half))
+}
+
+// ConnState exposer client 到 exposer server 的会话状态
+type ConnState string
+
+const (
+	ConnStateConnecting ConnState = "connecting"
+	ConnStateConnected  ConnState = "connected"
+	ConnStateBackingOff ConnState = "backing-off"
+	ConnStateClosed     ConnState = "closed"
+)
+
+// ServiceStatus 一个已暴露服务的状态。设备的所有服务复用同一个会话，所以连接状态相同。
+type ServiceStatus struct {
+	ServiceID string    `json:"service_id"`
+	Target    string    `json:"target"`
+	Dynamic   bool      `json:"dynamic,omitempty"` // 通过控制接口暴露
+	State     ConnState `json:"state"`
+	Since     time.Time `json:"since"`    // 进入当前状态的时间
+	Attempts  int       `json:"attempts"` // 连续失败的重连次数
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// connStatus 会话状态，由 run 维护
+type connStatus struct {
+	mu        sync.Mutex
+	state     ConnState
+	since     time.Time
+	attempts  int
+	lastError error
+}
+
+func (s *connStatus) set(state ConnState, attempts int, lastError error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state != state {
+		s.since = time.Now()
+	}
+	s.state, s.attempts, s.lastError = state, attempts, lastError
+}
+
+func (s *connStatus) get() (ConnState, time.Time, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state, s.since, s.attempts, s.lastError
+}
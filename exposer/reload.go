@@ -0,0 +1,86 @@
+package exposer
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/helper"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+)
+
+// reloadPollInterval 检查配置文件是否变化的间隔
+const reloadPollInterval = 2 * time.Second
+
+// ServiceLoader 返回设备当前需要暴露的服务列表：<service-id> => 目标地址
+type ServiceLoader func() (map[string]Target, error)
+
+// Reload 将已暴露的服务调整为 services：暴露新增的服务，取消已删除的服务，目标地址变化的服务原地修改。
+// 设备的会话和已经建立的 access stream 不受影响，只上报一次服务列表。
+// 通过控制接口暴露的服务不受影响。
+// 与 ExposeTarget 一样校验服务 ID 和目标地址，不允许的新增服务不会暴露，不允许的修改保持原来的目标地址。
+func (c *ExposerClient) Reload(services map[string]Target) (added, removed, changed []string) {
+	denied := map[string]bool{}
+	for id, target := range services {
+		err := ValidateServiceID(id)
+		if err == nil {
+			err = c.checkTarget(target)
+		}
+		if err != nil {
+			c.logger().Error("reload reject service", logging.KeyServiceID, id, logging.Err(err))
+			denied[id] = true
+		}
+	}
+	c.exposedFlags.Range(func(key, value interface{}) bool {
+		id, svc := key.(string), value.(*exposedService)
+		if svc.Dynamic {
+			return true
+		}
+		target, ok := services[id]
+		switch {
+		case !ok:
+			c.exposedFlags.Delete(id)
+			removed = append(removed, id)
+		case target != svc.Target && !denied[id]:
+			// 只影响之后的 access stream
+			c.exposedFlags.Store(id, &exposedService{ServiceID: id, Target: target})
+			changed = append(changed, id)
+		}
+		return true
+	})
+	for id, target := range services {
+		if denied[id] {
+			continue
+		}
+		if _, loaded := c.exposedFlags.LoadOrStore(id, &exposedService{ServiceID: id, Target: target}); !loaded {
+			added = append(added, id)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	if len(added) > 0 {
+		c.startOnce.Do(func() {
+			c.wg.Add(1)
+			go c.run()
+		})
+	}
+	if len(added) > 0 || len(removed) > 0 {
+		c.advertise()
+	}
+	c.logger().Info("reload services", "added", added, "removed", removed, "changed", changed)
+	return added, removed, changed
+}
+
+// WatchReload 收到 SIGHUP 或 path 文件发生变化时，通过 load 重新读取服务列表并 Reload，直到 Close。
+// path 为空时只响应 SIGHUP。读取失败时保持当前的服务列表不变。
+func (c *ExposerClient) WatchReload(path string, load ServiceLoader) {
+	helper.WatchReload(path, reloadPollInterval, c.wantCloseChan, func(reason string) {
+		c.logger().Info("reload triggered", "reason", reason, "path", path)
+		services, err := load()
+		if err != nil {
+			c.logger().Error("reload services error, keep current services", logging.Err(err))
+			return
+		}
+		c.Reload(services)
+	})
+}
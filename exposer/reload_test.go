@@ -0,0 +1,45 @@
+package exposer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReloadRejectsDeniedTargets(t *testing.T) {
+	// 没有 exposer server，client 只会在后台重连
+	c := NewExposerClient("DEVICE-0000", "ws://127.0.0.1:1")
+	defer c.Close()
+	mustTarget := func(s string) Target {
+		target, err := ParseTarget(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return target
+	}
+
+	added, _, _ := c.Reload(map[string]Target{
+		"demo1":  mustTarget("127.0.0.1:8081"),
+		"demo2":  mustTarget("127.0.0.1:8082"),
+		"camera": mustTarget("192.168.1.20:554"), // 不在 DefaultAllowedCIDRs 中
+		"demo:3": mustTarget("127.0.0.1:8083"),   // 服务 ID 不合法
+	})
+	if want := []string{"demo1", "demo2"}; !reflect.DeepEqual(added, want) {
+		t.Fatalf("added = %v, want %v", added, want)
+	}
+	if _, ok := c.exposedFlags.Load("camera"); ok {
+		t.Fatal("denied target exposed")
+	}
+
+	// 修改为不允许的目标地址时保持原来的目标地址
+	_, _, changed := c.Reload(map[string]Target{
+		"demo1": mustTarget("10.0.0.1:8081"),
+		"demo2": mustTarget("127.0.0.1:9082"),
+	})
+	if want := []string{"demo2"}; !reflect.DeepEqual(changed, want) {
+		t.Fatalf("changed = %v, want %v", changed, want)
+	}
+	svc, _ := c.exposedFlags.Load("demo1")
+	if got := svc.(*exposedService).Target; got != mustTarget("127.0.0.1:8081") {
+		t.Fatalf("demo1 target = %s, want unchanged", got)
+	}
+}
@@ -1,48 +1,129 @@
 package exposer
 
 import (
+	"crypto/tls"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/go-redis/redis"
 	"github.com/gorilla/websocket"
 	"github.com/hashicorp/yamux"
-	"github.com/rectcircle/expose-edge-service-demo/demo"
+	"github.com/rectcircle/expose-edge-service-demo/auth"
 	"github.com/rectcircle/expose-edge-service-demo/helper"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+	"github.com/rectcircle/expose-edge-service-demo/metrics"
+	"github.com/rectcircle/expose-edge-service-demo/policy"
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
 )
 
 type ExposerServer struct {
-	upgrader         websocket.Upgrader
-	globalRouteTable *redis.Client // exposer-route-table:<service-id>:<device-id> => expose server ip:port
-	myIP             string
-	myPort           int
-	mySessionTable   sync.Map // exposer-route-table:<service-id>:<device-id> => *yamux.Session (client)
+	// Authenticator 校验 expose 请求的设备凭证，为 nil 时不校验
+	Authenticator auth.Authenticator
+	// AccessAuthorizer 校验 access 请求的调用方是否可以访问目标设备的服务，为 nil 时不校验
+	AccessAuthorizer policy.Authorizer
+	// MaxForwardHops access 请求在 exposer server 之间转发的最大跳数
+	MaxForwardHops int
+	// TLSConfig 不为 nil 时监听 wss://，设备和协议转换服务需要使用 wss:// 连接
+	TLSConfig *tls.Config
+	// PeerTLSConfig 启用 tls 时，access 请求转发到其他 exposer server 使用的 tls 配置，为 nil 时使用系统根证书
+	PeerTLSConfig *tls.Config
+	// PeerSecret 集群内 exposer server 共享的密钥。配置后转发的 access 请求带有本节点的签名，
+	// 目标节点信任转发节点已经鉴权的调用方身份（例如 mTLS 客户端证书，不能随请求转发），且只信任签名请求中的跳数。
+	// 为 nil 时目标节点使用透传的 header 重新鉴权，只有 bearer token、api key 等 header 凭证可以被转发
+	PeerSecret []byte
+	// AdminResolver 认证管理接口（参见 adminapi.go）的调用方，能解析出身份的调用方即管理员，为 nil 时不提供管理接口
+	AdminResolver auth.IdentityResolver
+	Logger        *slog.Logger
+
+	upgrader          websocket.Upgrader
+	globalRouteTable  routetable.RouteTable // (service-id, device-id) => expose server ip:port
+	myIP              string
+	myPort            int
+	keepaliveInterval time.Duration // 测试中会缩短
+	mySessionTable    sync.Map      // exposer-route-table:<service-id>:<device-id> => *deviceSession
+	myDeviceSessions  sync.Map      // *deviceSession => struct{}，包括还没有上报服务的会话
+
+	httpServer     *http.Server
+	draining       int32 // 1 表示正在 Shutdown，不再接受新的 expose 请求
+	inflightAccess int64 // 正在处理的 access 请求数
+	shutdownChan   chan struct{}
+	shutdownOnce   sync.Once
+}
+
+// deviceSession 一个设备与本节点之间的 yamux 会话，设备暴露的全部服务复用该会话
+type deviceSession struct {
+	deviceID   string
+	sessionID  string
+	session    *yamux.Session // client
+	logger     *slog.Logger
+	remoteAddr string
+	since      time.Time // 会话建立的时间
+	generation int64     // 会话的代数，用于路由表 fencing，参见 routetable.Route
+
+	bytesToEdge   int64 // 会话上写入的字节数，包括 yamux 帧头
+	bytesFromEdge int64 // 会话上读取的字节数，包括 yamux 帧头
+	rtt           int64 // 最近一次心跳的往返时间，纳秒，0 表示还没有测量
+
+	controlMu sync.Mutex
+	control   net.Conn // 控制流，server -> 设备方向用于发送 go-away
+
+	mu       sync.Mutex
+	services map[string]routetable.Route // 设备通过控制流上报的服务 => 本会话注册的路由
+	goneAway bool                        // 已经发送 go-away，不再接受设备上报的服务
 }
 
-func NewExposerServer(port int) (*ExposerServer, error) {
+const (
+	// routeTTL 路由表记录的过期时间，keepalive 会定期刷新
+	routeTTL = 60 * time.Second
+	// controlStreamTimeout 会话建立后，设备需要在该时间内打开控制流
+	controlStreamTimeout = 10 * time.Second
+	// defaultKeepaliveInterval keepalive 刷新路由和测量心跳的间隔
+	defaultKeepaliveInterval = 5 * time.Second
+)
+
+func NewExposerServer(port int, routeTable routetable.RouteTable) (*ExposerServer, error) {
 	myIP, err := helper.GetIP()
 	if err != nil {
 		return nil, err
 	}
-	return &ExposerServer{
-		upgrader:         websocket.Upgrader{},
-		globalRouteTable: redis.NewClient(&redis.Options{Addr: demo.DemoRedisAddr}),
-		myIP:             myIP,
-		myPort:           port,
-		mySessionTable:   sync.Map{},
-	}, nil
+	s := &ExposerServer{
+		MaxForwardHops:    defaultMaxForwardHops,
+		Logger:            slog.Default().With(logging.KeyComponent, metrics.ComponentExposerServer),
+		upgrader:          websocket.Upgrader{},
+		globalRouteTable:  routeTable,
+		myIP:              myIP,
+		myPort:            port,
+		keepaliveInterval: defaultKeepaliveInterval,
+		mySessionTable:    sync.Map{},
+		shutdownChan:      make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle(AdminAPIPrefix, s.adminAPIHandler())
+	mux.HandleFunc("/", s.serve)
+	s.httpServer = &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: mux}
+	return s, nil
 }
 
-func (s *ExposerServer) Run() {
+// Run 启动 exposer server，阻塞直到 Shutdown 完成或监听出错
+func (s *ExposerServer) Run() error {
 	go s.keepalive()
-	http.HandleFunc("/", s.serve)
-	log.Printf("[exposer server] listening on :%d", s.myPort)
-	if err := http.ListenAndServe(fmt.Sprintf(":%d", s.myPort), nil); err != nil {
-		panic(err)
+	s.Logger.Info("listening", "port", s.myPort, "tls", s.TLSConfig != nil)
+	var err error
+	if s.TLSConfig != nil {
+		s.httpServer.TLSConfig = s.TLSConfig
+		err = s.httpServer.ListenAndServeTLS("", "")
+	} else {
+		err = s.httpServer.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		return err
 	}
+	return nil
 }
 
 func (s *ExposerServer) serve(w http.ResponseWriter, r *http.Request) {
@@ -50,7 +131,7 @@ func (s *ExposerServer) serve(w http.ResponseWriter, r *http.Request) {
 	edgeDeviceID := r.Header.Get(EdgeDeviceIDHeaderKey)
 	edgeServiceID := r.Header.Get(EdgeServiceIDHeaderKey)
 	if edgeFlowType == EdgeFlowTypeExpose {
-		s.expose(w, r, edgeDeviceID, edgeServiceID)
+		s.expose(w, r, edgeDeviceID)
 	} else if edgeFlowType == EdgeFlowTypeAccess {
 		s.access(w, r, edgeDeviceID, edgeServiceID)
 	} else {
@@ -58,98 +139,347 @@ func (s *ExposerServer) serve(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *ExposerServer) expose(w http.ResponseWriter, r *http.Request, edgeDeviceID, edgeServiceID string) {
-	log.Printf("[exposer server][device %s, service %s] expose request", edgeDeviceID, edgeServiceID)
-	// 应该添加对 device id 和 service id 的校验。本 demo 省略该逻辑。
+func (s *ExposerServer) expose(w http.ResponseWriter, r *http.Request, edgeDeviceID string) {
+	l := s.Logger.With(logging.KeyFlowType, EdgeFlowTypeExpose, logging.KeyDeviceID, edgeDeviceID, logging.KeyRemoteAddr, r.RemoteAddr)
+	l.Debug("expose request")
+	if s.isDraining() {
+		l.Info("server is draining, reject expose")
+		helper.RespString(w, 503, "service unavailable: server is draining")
+		return
+	}
+	if edgeDeviceID == "" {
+		// 没有设备 ID header 时，使用客户端证书中的设备 ID
+		if cert := auth.VerifiedClientCert(r); cert != nil {
+			if ids := auth.CertDeviceIDs(cert); len(ids) > 0 {
+				edgeDeviceID = ids[0]
+				l = l.With(logging.KeyDeviceID, edgeDeviceID)
+			}
+		}
+	}
+	if edgeDeviceID == "" {
+		helper.RespString(w, 400, fmt.Sprintf("bad request: %s header not exist", EdgeDeviceIDHeaderKey))
+		return
+	}
+	if err := routetable.ValidateID(edgeDeviceID); err != nil {
+		helper.RespString(w, 400, "bad request: device id: "+err.Error())
+		return
+	}
+	if s.Authenticator != nil {
+		if err := s.Authenticator.Authenticate(r, edgeDeviceID, ""); err != nil {
+			l.Warn("expose authenticate error", logging.Err(err))
+			helper.RespString(w, auth.StatusCode(err), "authenticate error: "+err.Error())
+			return
+		}
+		l.Debug("expose authenticate success")
+	}
+	// 会话代数由路由表分配，不依赖各个 exposer server 的时钟
+	generation, err := s.globalRouteTable.NextGeneration()
+	if err != nil {
+		l.Error("allocate session generation error", logging.Err(err))
+		helper.RespString(w, 503, "service unavailable: route table error: "+err.Error())
+		return
+	}
 	wsConn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("[exposer server][device %s, service %s] expose websocket upgrade error: %s", edgeDeviceID, edgeServiceID, err.Error())
+		l.Warn("expose websocket upgrade error", logging.Err(err))
 		helper.RespString(w, 500, "upgrade error: "+err.Error())
 		return
 	}
-	log.Printf("[exposer server][device %s, service %s] expose websocket upgrade success", edgeDeviceID, edgeServiceID)
-	// 构建一个 session
-	session, err := yamux.Client(&helper.WebsocketConnWrapper{WsConn: wsConn}, nil)
+	l.Debug("expose websocket upgrade success")
+	ds := &deviceSession{
+		deviceID:   edgeDeviceID,
+		remoteAddr: r.RemoteAddr,
+		since:      time.Now(),
+		generation: generation,
+		services:   map[string]routetable.Route{},
+	}
+	sessionID := logging.NewSessionID()
+	l = l.With(logging.KeySessionID, sessionID)
+	// 构建一个 session，设备的所有服务复用该 session
+	session, err := yamux.Client(&helper.CountingConn{
+		Conn:    &helper.WebsocketConnWrapper{WsConn: wsConn},
+		OnRead:  func(n int) { atomic.AddInt64(&ds.bytesFromEdge, int64(n)) },
+		OnWrite: func(n int) { atomic.AddInt64(&ds.bytesToEdge, int64(n)) },
+	}, yamuxConfig(l))
 	if err != nil {
-		log.Printf("[exposer server][device %s, service %s] make yamux client session error: %s", edgeDeviceID, edgeServiceID, err.Error())
-		helper.RespString(w, 500, "internal error: "+err.Error())
+		l.Error("make yamux client session error", logging.Err(err))
+		_ = wsConn.Close()
 		return
 	}
-	log.Printf("[exposer server][device %s, service %s] make yamux client session success", edgeDeviceID, edgeServiceID)
-	// 记录到全局路由表（redis）
-	routeKey := helper.RouteKey(edgeServiceID, edgeDeviceID)
-	err = s.globalRouteTable.Set(routeKey, s.myIPPort(), 60*time.Second).Err()
+	l.Debug("make yamux client session success")
+	// 等待设备打开控制流
+	timer := time.AfterFunc(controlStreamTimeout, func() { _ = session.Close() })
+	control, err := session.Accept()
+	timer.Stop()
 	if err != nil {
-		log.Printf("[exposer server][device %s, service %s] record route table %s error: %s", edgeDeviceID, edgeServiceID, s.myIPPort(), err.Error())
-		helper.RespString(w, 500, "internal error: "+err.Error())
+		l.Warn("accept control stream error", logging.Err(err))
+		_ = session.Close()
 		return
 	}
-	log.Printf("[exposer server][device %s, service %s] record route table %s success", edgeDeviceID, edgeServiceID, s.myIPPort())
-	// 将会话保存到会话表中
-	s.mySessionTable.Store(routeKey, session)
+	l.Info("device session established")
+	ds.sessionID, ds.session, ds.logger, ds.control = sessionID, session, l, control
+	s.myDeviceSessions.Store(ds, struct{}{})
+	if s.isDraining() {
+		// Shutdown 遍历会话时可能还没有看到该会话
+		go s.goAway(ds, GoAwayReasonShutdown)
+	}
+	go s.serveControl(ds, control)
 	// 等待断开连接
 	<-session.CloseChan()
-	log.Printf("[exposer server][device %s, service %s] yamux client session has closed, will remove route table and session table", edgeDeviceID, edgeServiceID)
+	l.Info("device session closed, will remove route table and session table")
 	// 断连后清空路由表
-	s.mySessionTable.Delete(routeKey)
-	s.globalRouteTable.Del(routeKey)
+	s.myDeviceSessions.Delete(ds)
+	s.updateServices(ds, nil)
+}
+
+// serveControl 处理设备通过控制流发送的消息，控制流出错时关闭整个会话
+func (s *ExposerServer) serveControl(ds *deviceSession, control net.Conn) {
+	defer ds.session.Close()
+	defer control.Close()
+	for {
+		var msg controlMessage
+		if err := readFrame(control, &msg); err != nil {
+			ds.logger.Debug("read control stream error", logging.Err(err))
+			return
+		}
+		switch msg.Op {
+		case controlOpServices:
+			s.updateServices(ds, msg.Services)
+		default:
+			ds.logger.Warn("unknown control op", "op", msg.Op)
+		}
+	}
+}
+
+// updateServices 将设备会话上暴露的服务更新为 services，同步更新会话表和路由表。
+// 同一设备的旧会话（本节点或其他节点）会被更新的会话接管并收到 go-away
+func (s *ExposerServer) updateServices(ds *deviceSession, services []string) {
+	for _, superseded := range s.updateServicesLocked(ds, services) {
+		s.goAway(superseded, GoAwayReasonSuperseded)
+	}
+}
+
+// updateServicesLocked 在 ds.mu 下更新服务，返回需要发送 go-away 的会话
+func (s *ExposerServer) updateServicesLocked(ds *deviceSession, services []string) (superseded []*deviceSession) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	// 与 goAway 设置 goneAway 使用同一个锁：Shutdown 先设置 draining 再向每个会话发送 go-away，
+	// 在这里检查 draining 可以保证下线开始后不会再注册路由
+	if len(services) > 0 && (ds.goneAway || s.isDraining()) {
+		ds.logger.Info("session has gone away or server is draining, ignore services", "services", services)
+		return nil
+	}
+	want := make(map[string]struct{}, len(services))
+	for _, edgeServiceID := range services {
+		want[edgeServiceID] = struct{}{}
+	}
+	for edgeServiceID := range want {
+		if _, ok := ds.services[edgeServiceID]; ok {
+			continue
+		}
+		l := ds.logger.With(logging.KeyServiceID, edgeServiceID)
+		if err := routetable.ValidateID(edgeServiceID); err != nil {
+			l.Warn("invalid service id, ignore", logging.Err(err))
+			continue
+		}
+		route := s.myRoute(edgeServiceID, ds)
+		// 记录到全局路由表，路由已经属于更新的会话时本会话被接管
+		err := s.globalRouteTable.Register(route, routeTTL)
+		if err == routetable.ErrNotOwner {
+			l.Warn("route owned by a newer session, this session is superseded")
+			return append(superseded, ds)
+		}
+		if err != nil {
+			l.Error("record route table error", "addr", s.myIPPort(), logging.Err(err))
+			continue
+		}
+		l.Info("service exposed", "addr", s.myIPPort())
+		// 将会话保存到会话表中，本节点上同一设备的旧会话被接管
+		if old, loaded := s.mySessionTable.Swap(helper.RouteKey(edgeServiceID, ds.deviceID), ds); loaded && old.(*deviceSession) != ds {
+			l.Info("supersede older session on this node", "old_session_id", old.(*deviceSession).sessionID)
+			superseded = append(superseded, old.(*deviceSession))
+		}
+		ds.services[edgeServiceID] = route
+		metrics.SessionServiceExposed(ds.deviceID, edgeServiceID)
+	}
+	for edgeServiceID, route := range ds.services {
+		if _, ok := want[edgeServiceID]; ok {
+			continue
+		}
+		l := ds.logger.With(logging.KeyServiceID, edgeServiceID)
+		l.Info("service removed, will remove route table and session table")
+		// 会话表和路由表中的记录可能已经属于更新的会话，只删除自己的
+		s.mySessionTable.CompareAndDelete(helper.RouteKey(edgeServiceID, ds.deviceID), ds)
+		if err := s.globalRouteTable.Unregister(route); err == routetable.ErrNotOwner {
+			l.Info("route owned by a newer session, skip unregister")
+		} else if err != nil {
+			l.Error("remove route table error", logging.Err(err))
+		}
+		delete(ds.services, edgeServiceID)
+		metrics.SessionServiceRemoved(ds.deviceID, edgeServiceID)
+	}
+	return superseded
+}
+
+// route 返回本会话为 edgeServiceID 注册的路由
+func (ds *deviceSession) route(edgeServiceID string) (routetable.Route, bool) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	route, ok := ds.services[edgeServiceID]
+	return route, ok
+}
+
+// refreshRoute 刷新会话为 edgeServiceID 注册的路由。与 updateServicesLocked 一样在 ds.mu 下检查 goneAway 和 draining，
+// 避免 goAway 删除路由后又被刷新写回
+func (s *ExposerServer) refreshRoute(ds *deviceSession, edgeServiceID string) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	route, ok := ds.services[edgeServiceID]
+	if !ok || ds.goneAway || s.isDraining() {
+		return nil // 服务正在被删除，或会话正在下线
+	}
+	return s.globalRouteTable.Refresh(route, routeTTL)
 }
 
 func (s *ExposerServer) myIPPort() string {
 	return fmt.Sprintf("%s:%d", s.myIP, s.myPort)
 }
 
+func (s *ExposerServer) myRoute(edgeServiceID string, ds *deviceSession) routetable.Route {
+	return routetable.Route{
+		ServiceID:  edgeServiceID,
+		DeviceID:   ds.deviceID,
+		Addr:       s.myIPPort(),
+		SessionID:  ds.sessionID,
+		Generation: ds.generation,
+	}
+}
+
 func (s *ExposerServer) access(w http.ResponseWriter, r *http.Request, edgeDeviceID, edgeServiceID string) {
-	log.Printf("[exposer server][device %s, service %s] access request", edgeDeviceID, edgeServiceID)
-	sessionI, ok := s.mySessionTable.Load(helper.RouteKey(edgeServiceID, edgeDeviceID))
-	if !ok {
-		log.Printf("[exposer server][device %s, service %s] session not found", edgeDeviceID, edgeServiceID)
-		helper.RespString(w, 400, "bad request: not found the session")
-	}
-	log.Printf("[exposer server][device %s, service %s] get session success", edgeDeviceID, edgeServiceID)
-	session := sessionI.(*yamux.Session)
-	if session.IsClosed() {
-		log.Printf("[exposer server][device %s, service %s] session closed", edgeDeviceID, edgeServiceID)
-		helper.RespString(w, 400, "bad request: session closed")
+	l := s.Logger.With(logging.KeyFlowType, EdgeFlowTypeAccess, logging.KeyDeviceID, edgeDeviceID, logging.KeyServiceID, edgeServiceID, logging.KeyRemoteAddr, r.RemoteAddr)
+	l.Debug("access request")
+	atomic.AddInt64(&s.inflightAccess, 1)
+	defer atomic.AddInt64(&s.inflightAccess, -1)
+	hops, err := parseHopCount(r.Header.Get(EdgeHopCountHeaderKey))
+	if err != nil {
+		l.Warn("access bad hop count", logging.Err(err))
+		metrics.AccessFailed(metrics.ComponentExposerServer, "bad_request")
+		helper.RespString(w, 400, "bad request: "+err.Error())
 		return
 	}
-	nextConn, err := session.Open()
+	identity, fromPeer, err := s.verifyPeer(r, edgeDeviceID, edgeServiceID)
 	if err != nil {
-		log.Printf("[exposer server][device %s, service %s] open session error: %s", edgeDeviceID, edgeServiceID, err.Error())
+		l.Warn("access verify peer error", logging.Err(err))
+		metrics.AccessFailed(metrics.ComponentExposerServer, "unauthorized")
+		helper.RespString(w, auth.StatusCode(err), "verify peer error: "+err.Error())
+		return
+	}
+	if fromPeer {
+		// 转发节点已经鉴权
+		l = l.With("identity", identity.String(), "hops", hops)
+		l.Debug("access forwarded by peer")
+	} else {
+		if s.PeerSecret != nil {
+			// 只信任 peer 请求中的跳数，调用方不能通过伪造跳数绕过 MaxForwardHops
+			hops = 0
+		}
+		if s.AccessAuthorizer != nil {
+			identity, err = s.AccessAuthorizer.Authorize(r, edgeDeviceID, edgeServiceID)
+			if err != nil {
+				l.Warn("access authorize error", "identity", identity.String(), logging.Err(err))
+				metrics.AccessFailed(metrics.ComponentExposerServer, "unauthorized")
+				helper.RespString(w, auth.StatusCode(err), "authorize error: "+err.Error())
+				return
+			}
+			l = l.With("identity", identity.String())
+			l.Debug("access authorize success")
+		}
+	}
+	dsI, ok := s.mySessionTable.Load(helper.RouteKey(edgeServiceID, edgeDeviceID))
+	if !ok || dsI.(*deviceSession).session.IsClosed() {
+		// 会话不在本节点，通过路由表找到持有会话的节点并转发
+		l.Debug("session not found in this node, try forward")
+		s.forward(w, r, l, identity, hops, edgeDeviceID, edgeServiceID)
+		return
+	}
+	ds := dsI.(*deviceSession)
+	l = l.With(logging.KeySessionID, ds.sessionID)
+	nextConn, err := ds.session.Open()
+	if err != nil {
+		l.Warn("open stream error", logging.Err(err))
+		metrics.AccessFailed(metrics.ComponentExposerServer, "open_stream")
 		helper.RespString(w, 500, "open session error: "+err.Error())
+		return
 	}
-	log.Printf("[exposer server][device %s, service %s] open session success", edgeDeviceID, edgeServiceID)
+	l.Debug("open stream success")
 	defer nextConn.Close()
+	// 告诉设备这个 stream 访问的是哪个服务
+	if err := writeFrame(nextConn, streamHeader{ServiceID: edgeServiceID}); err != nil {
+		l.Warn("write stream header error", logging.Err(err))
+		metrics.AccessFailed(metrics.ComponentExposerServer, "stream_header")
+		helper.RespString(w, 500, "write stream header error: "+err.Error())
+		return
+	}
 	wsConn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("[exposer server][device %s, service %s] access websocket upgrade error: %s", edgeDeviceID, edgeServiceID, err.Error())
+		l.Warn("access websocket upgrade error", logging.Err(err))
+		metrics.AccessFailed(metrics.ComponentExposerServer, "upgrade")
 		helper.RespString(w, 500, "upgrade error: "+err.Error())
 		return
 	}
-	log.Printf("[exposer server][device %s, service %s] access websocket upgrade success", edgeDeviceID, edgeServiceID)
+	l.Debug("access websocket upgrade success")
+	metrics.AccessOpened(metrics.ComponentExposerServer, edgeDeviceID, edgeServiceID)
 	wsConnWrapper := &helper.WebsocketConnWrapper{WsConn: wsConn}
 	defer wsConnWrapper.Close()
-	// _, err = helper. (nextConn, wsConnWrapper)
-	err = helper.IORelay(nextConn, wsConnWrapper)
+	err = helper.IORelayCounted(nextConn, wsConnWrapper,
+		metrics.RelayCounter(metrics.ComponentExposerServer, metrics.DirectionToEdge),
+		metrics.RelayCounter(metrics.ComponentExposerServer, metrics.DirectionFromEdge))
 	if err != nil {
-		log.Printf("[exposer server][device %s, service %s] access IORelay error: %s", edgeDeviceID, edgeServiceID, err.Error())
+		l.Debug("access IORelay error", logging.Err(err))
 	}
-	log.Printf("[exposer server][device %s, service %s] access finish", edgeDeviceID, edgeServiceID)
+	l.Debug("access finish")
 }
 
 func (s *ExposerServer) keepalive() {
 	for {
 		s.mySessionTable.Range(func(key, value interface{}) bool {
-			session := value.(*yamux.Session)
-			if session.IsClosed() {
-				log.Printf("[exposer server][keepalive] session %s closed, will remove route table and session table", key)
-				s.mySessionTable.Delete(key)
-				s.globalRouteTable.Del(key.(string))
-			} else {
-				s.globalRouteTable.Set(key.(string), s.myIPPort(), 60*time.Second)
+			if s.isDraining() {
+				return false // 正在下线，路由已经删除，不能再刷新
+			}
+			ds := value.(*deviceSession)
+			edgeServiceID, _, _ := helper.ParseRouteKey(key.(string))
+			l := ds.logger.With(logging.KeyServiceID, edgeServiceID)
+			if ds.session.IsClosed() {
+				route, ok := ds.route(edgeServiceID)
+				if !ok {
+					return true // 服务正在被删除
+				}
+				l.Info("keepalive found session closed, will remove route table and session table")
+				s.mySessionTable.CompareAndDelete(key, ds)
+				if err := s.globalRouteTable.Unregister(route); err != nil && err != routetable.ErrNotOwner {
+					l.Error("keepalive remove route table error", logging.Err(err))
+				}
+				return true
 			}
+			err := s.refreshRoute(ds, edgeServiceID)
+			if err == routetable.ErrNotOwner {
+				// 设备已经在其他节点建立了更新的会话
+				l.Warn("keepalive found route owned by a newer session, this session is superseded")
+				go s.goAway(ds, GoAwayReasonSuperseded)
+			} else if err != nil {
+				l.Error("keepalive refresh route table error", logging.Err(err))
+			}
+			return true
+		})
+		// 测量每个会话的心跳往返时间，供管理接口展示
+		s.myDeviceSessions.Range(func(key, _ interface{}) bool {
+			go key.(*deviceSession).ping()
 			return true
 		})
-		time.Sleep(5 * time.Second)
+		select {
+		case <-s.shutdownChan:
+			return
+		case <-time.After(s.keepaliveInterval):
+		}
 	}
 }
@@ -0,0 +1,171 @@
+package exposer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrTargetNotAllowed 服务的目标地址不在 ExposerClient.AllowedCIDRs 中
+var ErrTargetNotAllowed = errors.New("target address not allowed")
+
+// dialTargetTimeout 连接服务目标地址的超时时间
+const dialTargetTimeout = 10 * time.Second
+
+// DefaultAllowedCIDRs 默认只允许访问本机的服务
+var DefaultAllowedCIDRs = []netip.Prefix{
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("::1/128"),
+}
+
+// Target 暴露的服务的目标地址，支持以下写法：
+//   - 8081：等价于 localhost:8081
+//   - host:port 或 tcp://host:port：设备本机或设备所在局域网的 tcp 服务（例如 PLC、摄像头），受 AllowedCIDRs 限制
+//   - udp://host:port：udp 服务，同样受 AllowedCIDRs 限制，数据报在 stream 上分帧传输（参见 helper.RelayDatagrams）
+//   - unix:///path/to.sock 或 unix:/path/to.sock：unix domain socket
+//   - pipe://name：本机具名端点，使用 linux abstract unix socket (@name)
+type Target struct {
+	Network string // tcp、udp 或 unix
+	Address string
+}
+
+func ParseTarget(s string) (Target, error) {
+	switch {
+	case s == "":
+		return Target{}, errors.New("empty target")
+	case strings.HasPrefix(s, "tcp://"):
+		return parseHostPortTarget("tcp", strings.TrimPrefix(s, "tcp://"))
+	case strings.HasPrefix(s, "udp://"):
+		return parseHostPortTarget("udp", strings.TrimPrefix(s, "udp://"))
+	case strings.HasPrefix(s, "unix://"), strings.HasPrefix(s, "unix:"):
+		path := strings.TrimPrefix(strings.TrimPrefix(s, "unix:"), "//")
+		if !strings.HasPrefix(path, "/") {
+			return Target{}, fmt.Errorf("target %q: unix socket path must be absolute", s)
+		}
+		return Target{Network: "unix", Address: path}, nil
+	case strings.HasPrefix(s, "pipe://"):
+		name := strings.TrimPrefix(s, "pipe://")
+		if name == "" || strings.ContainsAny(name, "/\x00") {
+			return Target{}, fmt.Errorf("target %q: bad pipe name", s)
+		}
+		return Target{Network: "unix", Address: "@" + name}, nil
+	case strings.Contains(s, "://"):
+		return Target{}, fmt.Errorf("target %q: unknown scheme, want tcp://, udp://, unix:// or pipe://", s)
+	}
+	if _, err := strconv.Atoi(s); err == nil {
+		return parseHostPortTarget("tcp", net.JoinHostPort("localhost", s))
+	}
+	return parseHostPortTarget("tcp", s)
+}
+
+// LocalPortTarget 本机端口的目标地址
+func LocalPortTarget(port int) Target {
+	return Target{Network: "tcp", Address: net.JoinHostPort("localhost", strconv.Itoa(port))}
+}
+
+func parseHostPortTarget(network, addr string) (Target, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return Target{}, fmt.Errorf("target %q: %w", addr, err)
+	}
+	if host == "" {
+		return Target{}, fmt.Errorf("target %q: empty host", addr)
+	}
+	if port, err := strconv.Atoi(portStr); err != nil || port <= 0 || port > 65535 {
+		return Target{}, fmt.Errorf("target %q: port must be in 1-65535", addr)
+	}
+	return Target{Network: network, Address: addr}, nil
+}
+
+func (t Target) String() string {
+	switch {
+	case t.Network == "udp":
+		return "udp://" + t.Address
+	case t.Network == "unix" && strings.HasPrefix(t.Address, "@"):
+		return "pipe://" + strings.TrimPrefix(t.Address, "@")
+	case t.Network == "unix":
+		return "unix://" + t.Address
+	default:
+		return t.Address
+	}
+}
+
+// ParseCIDRs 解析 AllowedCIDRs 配置，单个 ip 视为 /32 或 /128
+func ParseCIDRs(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, s := range cidrs {
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("bad cidr %q: %w", s, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad cidr %q: %w", s, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// targetAllowed tcp、udp 目标地址的 ip 是否在 AllowedCIDRs 中
+func (c *ExposerClient) targetAllowed(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, prefix := range c.AllowedCIDRs {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTarget 在暴露服务时提前检查 ip 字面量的目标地址，域名在连接时检查
+func (c *ExposerClient) checkTarget(t Target) error {
+	if t.Network == "unix" {
+		return nil
+	}
+	host, _, _ := net.SplitHostPort(t.Address)
+	if ip, err := netip.ParseAddr(host); err == nil && !c.targetAllowed(ip) {
+		return fmt.Errorf("%w: %s", ErrTargetNotAllowed, t)
+	}
+	return nil
+}
+
+// dialTarget 连接服务的目标地址。tcp、udp 目标先解析域名，只连接 AllowedCIDRs 中的 ip，
+// 避免隧道成为访问设备所在网络的开放代理（也避免 DNS rebinding 绕过检查）。
+func (c *ExposerClient) dialTarget(t Target) (net.Conn, error) {
+	if t.Network == "unix" {
+		return net.DialTimeout(t.Network, t.Address, dialTargetTimeout)
+	}
+	host, port, err := net.SplitHostPort(t.Address)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dialTargetTimeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error = fmt.Errorf("%w: %s", ErrTargetNotAllowed, t)
+	var d net.Dialer
+	for _, ip := range ips {
+		if !c.targetAllowed(ip) {
+			continue
+		}
+		conn, err := d.DialContext(ctx, t.Network, net.JoinHostPort(ip.Unmap().String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,108 @@
+package helper
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// udp 数据报通过 stream 传输时使用长度前缀分帧：2 字节大端长度 + 数据报
+
+// MaxDatagramSize 一个数据报的最大长度
+const MaxDatagramSize = 65535
+
+// ErrIdleTimeout 超过空闲时间没有数据
+var ErrIdleTimeout = errors.New("idle timeout")
+
+func WriteDatagram(w io.Writer, p []byte) error {
+	if len(p) > MaxDatagramSize {
+		return errors.New("datagram too large")
+	}
+	buf := make([]byte, 2+len(p))
+	binary.BigEndian.PutUint16(buf, uint16(len(p)))
+	copy(buf[2:], p)
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadDatagram 读取一个数据报到 buf，buf 的长度至少为 MaxDatagramSize
+func ReadDatagram(r io.Reader, buf []byte) (int, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return 0, err
+	}
+	n := int(binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(r, buf[:n]); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// RelayDatagrams 在 stream（长度前缀分帧）和已连接的 udp socket conn 之间转发数据报，
+// 任意一方出错或两个方向都超过 idleTimeout 没有数据时返回，返回后调用方负责关闭两个连接。
+// 每转发一个数据报，分别以数据报长度调用 toConn、toStream（可以为 nil）。
+func RelayDatagrams(stream io.ReadWriter, conn net.Conn, idleTimeout time.Duration, toConn, toStream func(n int)) error {
+	last := time.Now().UnixNano()
+	touch := func() { atomic.StoreInt64(&last, time.Now().UnixNano()) }
+	errc := make(chan error, 2)
+	go func() {
+		buf := make([]byte, MaxDatagramSize)
+		for {
+			n, err := ReadDatagram(stream, buf)
+			if err != nil {
+				errc <- err
+				return
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				errc <- err
+				return
+			}
+			touch()
+			if toConn != nil {
+				toConn(n)
+			}
+		}
+	}()
+	go func() {
+		buf := make([]byte, MaxDatagramSize)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				errc <- err
+				return
+			}
+			if err := WriteDatagram(stream, buf[:n]); err != nil {
+				errc <- err
+				return
+			}
+			touch()
+			if toStream != nil {
+				toStream(n)
+			}
+		}
+	}()
+	ticker := time.NewTicker(IdleCheckInterval(idleTimeout))
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-errc:
+			return err
+		case <-ticker.C:
+			if time.Since(time.Unix(0, atomic.LoadInt64(&last))) > idleTimeout {
+				return ErrIdleTimeout
+			}
+		}
+	}
+}
+
+// IdleCheckInterval 检查空闲超时的间隔
+func IdleCheckInterval(idleTimeout time.Duration) time.Duration {
+	interval := idleTimeout / 4
+	if interval < 100*time.Millisecond {
+		interval = 100 * time.Millisecond
+	}
+	return interval
+}
@@ -1,6 +1,9 @@
 package helper
 
-import "io"
+import (
+	"io"
+	"net"
+)
 
 func IORelay(a, b io.ReadWriter) error {
 	errc := make(chan error, 1)
@@ -14,3 +17,55 @@ func IORelay(a, b io.ReadWriter) error {
 	}()
 	return <-errc
 }
+
+// IORelayCounted 同 IORelay，每次写入 a、b 后分别以写入的字节数调用 toA、toB（可以为 nil）
+func IORelayCounted(a, b io.ReadWriter, toA, toB func(n int)) error {
+	return IORelay(&countingReadWriter{ReadWriter: a, onWrite: toA}, &countingReadWriter{ReadWriter: b, onWrite: toB})
+}
+
+type countingReadWriter struct {
+	io.ReadWriter
+	onWrite func(n int)
+}
+
+func (c *countingReadWriter) Write(p []byte) (int, error) {
+	n, err := c.ReadWriter.Write(p)
+	if c.onWrite != nil && n > 0 {
+		c.onWrite(n)
+	}
+	return n, err
+}
+
+// CountingConn 统计读写字节数的 net.Conn，用于无法使用 IORelayCounted 的场景（例如 http 反向代理）
+type CountingConn struct {
+	net.Conn
+	OnRead  func(n int)
+	OnWrite func(n int)
+}
+
+func (c *CountingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if c.OnRead != nil && n > 0 {
+		c.OnRead(n)
+	}
+	return n, err
+}
+
+func (c *CountingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if c.OnWrite != nil && n > 0 {
+		c.OnWrite(n)
+	}
+	return n, err
+}
+
+// BufferedConn 从 Reader 读取的 net.Conn，Reader 通常是包装了 Conn 的 bufio.Reader，
+// 用于 http Hijack 之后读取已经缓冲的数据
+type BufferedConn struct {
+	net.Conn
+	Reader io.Reader
+}
+
+func (c *BufferedConn) Read(p []byte) (int, error) {
+	return c.Reader.Read(p)
+}
@@ -0,0 +1,61 @@
+package helper
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// 触发重新加载的原因
+const (
+	ReloadReasonSignal      = "signal"
+	ReloadReasonFileChanged = "file_changed"
+)
+
+// WatchReload 收到 SIGHUP，或 path 文件发生变化（每 interval 比较一次修改时间和大小）时调用 reload，直到 stop 被关闭。
+// path 为空时只响应 SIGHUP。reload 在同一个 goroutine 中串行调用。
+func WatchReload(path string, interval time.Duration, stop <-chan struct{}, reload func(reason string)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		last := fileVersion(path)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-hup:
+				reload(ReloadReasonSignal)
+			case <-ticker.C:
+				if path == "" {
+					continue
+				}
+				current := fileVersion(path)
+				if current == last {
+					continue
+				}
+				last = current
+				reload(ReloadReasonFileChanged)
+			}
+		}
+	}()
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func fileVersion(path string) fileStamp {
+	if path == "" {
+		return fileStamp{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
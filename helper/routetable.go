@@ -1,5 +1,26 @@
 package helper
 
+import "strings"
+
+const RouteKeyPrefix = "exposer-route-table:"
+
+// RouteGenerationKey 会话代数计数器的 key，不能以 RouteKeyPrefix 开头，否则会被当作路由列出
+const RouteGenerationKey = "exposer-route-generation"
+
+// RouteKey 路由表中 (service, device) 的 key，设备 ID 和服务 ID 不能包含 `:`（参见 routetable.ValidateID）
 func RouteKey(serviceID, deviceID string) string {
-	return "exposer-route-table:" + serviceID + ":" + deviceID
+	return RouteKeyPrefix + serviceID + ":" + deviceID
+}
+
+// ParseRouteKey 是 RouteKey 的逆操作，按最后一个 `:` 拆分
+func ParseRouteKey(key string) (serviceID, deviceID string, ok bool) {
+	if !strings.HasPrefix(key, RouteKeyPrefix) {
+		return "", "", false
+	}
+	rest := strings.TrimPrefix(key, RouteKeyPrefix)
+	i := strings.LastIndex(rest, ":")
+	if i < 0 {
+		return "", "", false
+	}
+	return rest[:i], rest[i+1:], true
 }
@@ -0,0 +1,19 @@
+package helper
+
+import "testing"
+
+func TestParseRouteKey(t *testing.T) {
+	for _, tc := range []struct{ serviceID, deviceID string }{
+		{"demo1", "DEVICE-0000"},
+		{"demo:1", "DEVICE-0000"},
+		{"demo1", ""},
+	} {
+		serviceID, deviceID, ok := ParseRouteKey(RouteKey(tc.serviceID, tc.deviceID))
+		if !ok || serviceID != tc.serviceID || deviceID != tc.deviceID {
+			t.Errorf("ParseRouteKey(RouteKey(%q, %q)) = %q, %q, %v", tc.serviceID, tc.deviceID, serviceID, deviceID, ok)
+		}
+	}
+	if _, _, ok := ParseRouteKey("other:demo1:DEVICE-0000"); ok {
+		t.Error("ParseRouteKey without prefix want !ok")
+	}
+}
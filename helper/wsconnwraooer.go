@@ -1,13 +1,27 @@
 package helper
 
 import (
+	"crypto/tls"
 	"io"
 	"net"
+	"net/http"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// WebsocketDialer 返回使用 tlsConfig 连接 wss:// 的 Dialer，tlsConfig 为 nil 时等价于 websocket.DefaultDialer
+func WebsocketDialer(tlsConfig *tls.Config) *websocket.Dialer {
+	if tlsConfig == nil {
+		return websocket.DefaultDialer
+	}
+	return &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+		TLSClientConfig:  tlsConfig,
+	}
+}
+
 // https://github.com/gorilla/websocket/issues/282
 
 type WebsocketConnWrapper struct {
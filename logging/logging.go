@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// 日志中统一使用的属性名
+const (
+	KeyComponent  = "component"
+	KeyDeviceID   = "device_id"
+	KeyServiceID  = "service_id"
+	KeyFlowType   = "flow_type"
+	KeySessionID  = "session_id"
+	KeyRemoteAddr = "remote_addr"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Config 日志配置
+type Config struct {
+	Level  string `json:"level" yaml:"level" env:"EDGE_LOG_LEVEL" flag:"log-level" usage:"日志级别：debug、info、warn、error"`
+	Format string `json:"format" yaml:"format" env:"EDGE_LOG_FORMAT" flag:"log-format" usage:"日志格式：text、json"`
+}
+
+// New 根据配置创建输出到 w 的 logger
+func New(cfg Config, w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if cfg.Level != "" {
+		if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+			return nil, fmt.Errorf("bad log level %q: %w", cfg.Level, err)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(cfg.Format) {
+	case "", FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("bad log format %q: want %q or %q", cfg.Format, FormatText, FormatJSON)
+	}
+}
+
+// MustSetup 根据配置创建输出到 stderr 的 logger，并设置为 slog 的默认 logger
+func MustSetup(cfg Config) *slog.Logger {
+	logger, err := New(cfg, os.Stderr)
+	if err != nil {
+		panic(err)
+	}
+	slog.SetDefault(logger)
+	return logger
+}
+
+// NewSessionID 生成一个随机的会话 ID，用于关联同一个会话的日志
+func NewSessionID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Err 将 error 转换为日志属性
+func Err(err error) slog.Attr {
+	if err == nil {
+		return slog.String("error", "")
+	}
+	return slog.String("error", err.Error())
+}
@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
+)
+
+// component 标签的取值
+const (
+	ComponentExposerServer    = "exposer_server"
+	ComponentExposerClient    = "exposer_client"
+	ComponentHTTPProtoConv    = "http_protoconv"
+	ComponentTCPProtoConv     = "tcp_protoconv"
+	ComponentUDPProtoConv     = "udp_protoconv"
+	ComponentSOCKS5ProtoConv  = "socks5_protoconv"
+	ComponentConnectProtoConv = "connect_protoconv"
+)
+
+// direction 标签的取值
+const (
+	DirectionToEdge   = "to_edge"   // 调用方 -> 边缘服务
+	DirectionFromEdge = "from_edge" // 边缘服务 -> 调用方
+)
+
+var (
+	ActiveSessions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "exposer_server_active_sessions",
+		Help: "Number of services currently exposed through this exposer server.",
+	}, []string{"device_id", "service_id"})
+
+	// AccessStreamsOpened 只在调用方鉴权通过、路由存在之后记录，会话结束（路由删除）后删除对应的时间序列，参见 DeleteAccessSeriesOnRouteDelete
+	AccessStreamsOpened = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "exposer_access_streams_opened_total",
+		Help: "Number of access streams opened.",
+	}, []string{"component", "device_id", "service_id"})
+
+	// AccessStreamsFailed 失败时设备 ID 和服务 ID 来自未经鉴权的请求，不能作为标签，否则任意调用方都可以制造无限的时间序列
+	AccessStreamsFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "exposer_access_streams_failed_total",
+		Help: "Number of access streams that failed before relaying.",
+	}, []string{"component", "reason"})
+
+	RelayBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "exposer_relay_bytes_total",
+		Help: "Number of bytes relayed by helper.IORelay.",
+	}, []string{"component", "direction"})
+
+	RouteTableOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "exposer_route_table_operation_duration_seconds",
+		Help:    "Latency of route table operations.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	RouteTableOperationErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "exposer_route_table_operation_errors_total",
+		Help: "Number of failed route table operations.",
+	}, []string{"operation"})
+
+	ClientReconnects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "exposer_client_reconnects_total",
+		Help: "Number of reconnect attempts made by the exposer client.",
+	}, []string{"device_id"})
+
+	ClientConnected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "exposer_client_connected",
+		Help: "Whether the exposer client currently holds a session to an exposer server.",
+	}, []string{"device_id"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		ActiveSessions,
+		AccessStreamsOpened,
+		AccessStreamsFailed,
+		RelayBytes,
+		RouteTableOperationDuration,
+		RouteTableOperationErrors,
+		ClientReconnects,
+		ClientConnected,
+	)
+}
+
+// Handler 返回 /metrics 的 http handler
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ListenAndServe 在 addr 上单独提供 /metrics，用于自身占用了全部 path 的服务（例如 http 协议转换服务）
+func ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	return http.ListenAndServe(addr, mux)
+}
+
+// RelayCounter 返回统计 component 在 direction 方向上转发字节数的回调，用于 helper.IORelayCounted
+func RelayCounter(component, direction string) func(n int) {
+	c := RelayBytes.WithLabelValues(component, direction)
+	return func(n int) { c.Add(float64(n)) }
+}
+
+// AccessOpened 记录一个 access stream 建立成功，调用方需要已经通过鉴权、且路由存在
+func AccessOpened(component, deviceID, serviceID string) {
+	AccessStreamsOpened.WithLabelValues(component, deviceID, serviceID).Inc()
+}
+
+// AccessFailed 记录一个 access stream 建立失败
+func AccessFailed(component, reason string) {
+	AccessStreamsFailed.WithLabelValues(component, reason).Inc()
+}
+
+// DeleteAccessSeries 删除 component 上设备的 AccessStreamsOpened 时间序列，serviceID 为空时删除设备全部服务的时间序列
+func DeleteAccessSeries(component, deviceID, serviceID string) {
+	if serviceID != "" {
+		AccessStreamsOpened.DeleteLabelValues(component, deviceID, serviceID)
+		return
+	}
+	AccessStreamsOpened.DeletePartialMatch(prometheus.Labels{"component": component, "device_id": deviceID})
+}
+
+// DeleteAccessSeriesOnRouteDelete 监听路由表，路由删除（设备会话结束或过期）时删除 component 上该 (设备, 服务) 的
+// AccessStreamsOpened 时间序列，避免设备 ID 不断变化时时间序列无限增长。ctx 结束后停止
+func DeleteAccessSeriesOnRouteDelete(ctx context.Context, rt routetable.RouteTable, component string) error {
+	events, err := rt.Watch(ctx)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for e := range events {
+			if e.Type == routetable.EventTypeDelete {
+				DeleteAccessSeries(component, e.Route.DeviceID, e.Route.ServiceID)
+			}
+		}
+	}()
+	return nil
+}
+
+// activeSessions 每个 (设备, 服务) 上暴露该服务的会话数，同一设备在本节点上可能短暂存在新旧两个会话
+var activeSessions = struct {
+	sync.Mutex
+	counts map[[2]string]int
+}{counts: map[[2]string]int{}}
+
+// SessionServiceExposed 记录设备会话上暴露了一个服务
+func SessionServiceExposed(deviceID, serviceID string) {
+	activeSessions.Lock()
+	defer activeSessions.Unlock()
+	activeSessions.counts[[2]string{deviceID, serviceID}]++
+	ActiveSessions.WithLabelValues(deviceID, serviceID).Inc()
+}
+
+// SessionServiceRemoved 记录设备会话上的一个服务被删除（包括会话断开）。
+// 没有会话暴露该服务时删除对应的时间序列，避免设备 ID 不断变化时时间序列无限增长
+func SessionServiceRemoved(deviceID, serviceID string) {
+	activeSessions.Lock()
+	defer activeSessions.Unlock()
+	key := [2]string{deviceID, serviceID}
+	if activeSessions.counts[key] <= 1 {
+		delete(activeSessions.counts, key)
+		ActiveSessions.DeleteLabelValues(deviceID, serviceID)
+		return
+	}
+	activeSessions.counts[key]--
+	ActiveSessions.WithLabelValues(deviceID, serviceID).Dec()
+}
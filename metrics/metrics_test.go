@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
+)
+
+func TestSessionServiceRemovedDeletesSeries(t *testing.T) {
+	// 同一设备的新旧两个会话暴露了同一个服务
+	SessionServiceExposed("DEVICE-test", "demo1")
+	SessionServiceExposed("DEVICE-test", "demo1")
+	if got := testutil.ToFloat64(ActiveSessions.WithLabelValues("DEVICE-test", "demo1")); got != 2 {
+		t.Fatalf("active sessions = %v, want 2", got)
+	}
+	SessionServiceRemoved("DEVICE-test", "demo1")
+	if got := testutil.ToFloat64(ActiveSessions.WithLabelValues("DEVICE-test", "demo1")); got != 1 {
+		t.Fatalf("active sessions = %v, want 1", got)
+	}
+	SessionServiceRemoved("DEVICE-test", "demo1")
+	if n := testutil.CollectAndCount(ActiveSessions); n != 0 {
+		t.Fatalf("series count = %d, want 0", n)
+	}
+}
+
+func TestDeleteAccessSeriesOnRouteDelete(t *testing.T) {
+	rt := routetable.NewMemoryRouteTable()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := DeleteAccessSeriesOnRouteDelete(ctx, rt, ComponentHTTPProtoConv); err != nil {
+		t.Fatal(err)
+	}
+	route := routetable.Route{ServiceID: "demo1", DeviceID: "DEVICE-watch", Addr: "10.0.0.1:8080", SessionID: "s1", Generation: 1}
+	if err := rt.Register(route, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	AccessOpened(ComponentHTTPProtoConv, route.DeviceID, route.ServiceID)
+	AccessOpened(ComponentHTTPProtoConv, route.DeviceID, "demo2")
+	if err := rt.Unregister(route); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(AccessStreamsOpened.WithLabelValues(ComponentHTTPProtoConv, route.DeviceID, route.ServiceID)) != 0 {
+		// WithLabelValues 会重新创建被删除的时间序列，值为 0
+		if time.Now().After(deadline) {
+			t.Fatal("series not deleted after route deleted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// 路由仍然存在的服务不受影响
+	if got := testutil.ToFloat64(AccessStreamsOpened.WithLabelValues(ComponentHTTPProtoConv, route.DeviceID, "demo2")); got != 1 {
+		t.Fatalf("opened demo2 = %v, want 1", got)
+	}
+	DeleteAccessSeries(ComponentHTTPProtoConv, route.DeviceID, "")
+	if n := testutil.CollectAndCount(AccessStreamsOpened); n != 0 {
+		t.Fatalf("series count = %d, want 0", n)
+	}
+}
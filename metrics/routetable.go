@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
+)
+
+// instrumentedRouteTable 记录路由表操作的延迟和错误
+type instrumentedRouteTable struct {
+	routetable.RouteTable
+}
+
+// InstrumentRouteTable 包装 rt，记录每个操作的延迟和错误。ErrNotFound 和 ErrNotOwner 不计为错误。
+func InstrumentRouteTable(rt routetable.RouteTable) routetable.RouteTable {
+	return &instrumentedRouteTable{RouteTable: rt}
+}
+
+func observe(operation string, start time.Time, err error) {
+	RouteTableOperationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil && err != routetable.ErrNotFound && err != routetable.ErrNotOwner {
+		RouteTableOperationErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+func (t *instrumentedRouteTable) Register(route routetable.Route, ttl time.Duration) (err error) {
+	defer func(start time.Time) { observe("register", start, err) }(time.Now())
+	return t.RouteTable.Register(route, ttl)
+}
+
+func (t *instrumentedRouteTable) Refresh(route routetable.Route, ttl time.Duration) (err error) {
+	defer func(start time.Time) { observe("refresh", start, err) }(time.Now())
+	return t.RouteTable.Refresh(route, ttl)
+}
+
+func (t *instrumentedRouteTable) Lookup(serviceID, deviceID string) (route routetable.Route, err error) {
+	defer func(start time.Time) { observe("lookup", start, err) }(time.Now())
+	return t.RouteTable.Lookup(serviceID, deviceID)
+}
+
+func (t *instrumentedRouteTable) NextGeneration() (generation int64, err error) {
+	defer func(start time.Time) { observe("next_generation", start, err) }(time.Now())
+	return t.RouteTable.NextGeneration()
+}
+
+func (t *instrumentedRouteTable) Unregister(route routetable.Route) (err error) {
+	defer func(start time.Time) { observe("unregister", start, err) }(time.Now())
+	return t.RouteTable.Unregister(route)
+}
+
+func (t *instrumentedRouteTable) List() (routes []routetable.Route, err error) {
+	defer func(start time.Time) { observe("list", start, err) }(time.Now())
+	return t.RouteTable.List()
+}
+
+func (t *instrumentedRouteTable) Watch(ctx context.Context) (ch <-chan routetable.Event, err error) {
+	defer func(start time.Time) { observe("watch", start, err) }(time.Now())
+	return t.RouteTable.Watch(ctx)
+}
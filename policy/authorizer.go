@@ -0,0 +1,66 @@
+package policy
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/rectcircle/expose-edge-service-demo/auth"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+)
+
+// ErrDenied 访问策略拒绝，对应 403
+var ErrDenied = fmt.Errorf("%w: access denied", auth.ErrForbidden)
+
+// Authorizer 决定 access 请求的调用方是否可以访问 (device, service)
+type Authorizer interface {
+	Authorize(r *http.Request, deviceID, serviceID string) (auth.Identity, error)
+}
+
+// IdentityAuthorizer 决定已经认证的调用方是否可以访问 (device, service)，用于不经过 http 的协议（例如 SOCKS5）
+type IdentityAuthorizer interface {
+	AuthorizeIdentity(identity auth.Identity, remoteAddr, deviceID, serviceID string) error
+}
+
+// Engine 使用 IdentityResolver 解析调用方身份，再使用 Policy 做决策。每次拒绝都会记录审计日志。
+type Engine struct {
+	Resolver auth.IdentityResolver
+	Policy   *Policy
+	Logger   *slog.Logger
+}
+
+var (
+	_ Authorizer         = &Engine{}
+	_ IdentityAuthorizer = &Engine{}
+)
+
+func NewEngine(resolver auth.IdentityResolver, policy *Policy) *Engine {
+	return &Engine{Resolver: resolver, Policy: policy, Logger: slog.Default()}
+}
+
+func (e *Engine) Authorize(r *http.Request, deviceID, serviceID string) (auth.Identity, error) {
+	identity, err := e.Resolver.Resolve(r)
+	if err != nil {
+		e.audit(r.RemoteAddr, identity, deviceID, serviceID, err.Error())
+		return identity, err
+	}
+	return identity, e.AuthorizeIdentity(identity, r.RemoteAddr, deviceID, serviceID)
+}
+
+func (e *Engine) AuthorizeIdentity(identity auth.Identity, remoteAddr, deviceID, serviceID string) error {
+	if ok, reason := e.Policy.Evaluate(identity, deviceID, serviceID); !ok {
+		e.audit(remoteAddr, identity, deviceID, serviceID, reason)
+		return fmt.Errorf("%w: %s", ErrDenied, reason)
+	}
+	return nil
+}
+
+func (e *Engine) audit(remoteAddr string, identity auth.Identity, deviceID, serviceID, reason string) {
+	e.Logger.Warn("access deny",
+		"audit", true,
+		logging.KeyDeviceID, deviceID,
+		logging.KeyServiceID, serviceID,
+		logging.KeyRemoteAddr, remoteAddr,
+		"identity", identity.String(),
+		"reason", reason)
+}
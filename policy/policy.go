@@ -0,0 +1,101 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/rectcircle/expose-edge-service-demo/auth"
+)
+
+type Effect string
+
+const (
+	EffectAllow Effect = "allow"
+	EffectDeny  Effect = "deny"
+)
+
+// Rule 一条访问规则，Identities、Devices、Services 均为 glob 模式（path.Match 语法）。
+// Identities 匹配 `<method>:<name>`（参见 auth.Identity.String），例如 `bearer:demo-user`、`*:demo-user`，
+// 不同认证方式的同名身份是不同的调用方；未认证的调用方为 `anonymous`。
+type Rule struct {
+	Identities []string `json:"identities"`
+	Devices    []string `json:"devices"`
+	Services   []string `json:"services"`
+	Effect     Effect   `json:"effect"`
+}
+
+// Policy 访问策略。命中任意 deny 规则则拒绝，否则命中任意 allow 规则则允许，都不命中默认拒绝。
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// LoadFile 从 json 文件加载访问策略
+func LoadFile(filePath string) (*Policy, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	p := &Policy{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filePath, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filePath, err)
+	}
+	return p, nil
+}
+
+func (p *Policy) Validate() error {
+	for i, rule := range p.Rules {
+		if rule.Effect != EffectAllow && rule.Effect != EffectDeny {
+			return fmt.Errorf("rules[%d]: effect must be %q or %q", i, EffectAllow, EffectDeny)
+		}
+		for _, pattern := range rule.Identities {
+			// 只有名字的模式会让不同认证方式的同名身份获得相同的权限
+			if pattern != "*" && pattern != anonymousIdentity && !strings.Contains(pattern, ":") {
+				return fmt.Errorf("rules[%d]: identity pattern %q must be <method>:<name> or %s", i, pattern, anonymousIdentity)
+			}
+		}
+		for _, patterns := range [][]string{rule.Identities, rule.Devices, rule.Services} {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("rules[%d]: bad pattern %q: %w", i, pattern, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// anonymousIdentity 未认证调用方的身份，参见 auth.Identity.String
+const anonymousIdentity = "anonymous"
+
+// Evaluate 判断 identity 是否可以访问 (deviceID, serviceID)，返回决定是否允许以及原因
+func (p *Policy) Evaluate(identity auth.Identity, deviceID, serviceID string) (bool, string) {
+	allowed := false
+	for i, rule := range p.Rules {
+		if !matchAny(rule.Identities, identity.String()) || !matchAny(rule.Devices, deviceID) || !matchAny(rule.Services, serviceID) {
+			continue
+		}
+		if rule.Effect == EffectDeny {
+			return false, fmt.Sprintf("denied by rules[%d]", i)
+		}
+		allowed = true
+	}
+	if !allowed {
+		return false, "no rule matched"
+	}
+	return true, ""
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
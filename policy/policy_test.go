@@ -0,0 +1,52 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/rectcircle/expose-edge-service-demo/auth"
+)
+
+func TestPolicyEvaluateMatchesMethod(t *testing.T) {
+	p := &Policy{Rules: []Rule{
+		{Identities: []string{"bearer:demo-user"}, Devices: []string{"*"}, Services: []string{"demo*"}, Effect: EffectAllow},
+		{Identities: []string{"*:ops"}, Devices: []string{"*"}, Services: []string{"*"}, Effect: EffectAllow},
+		{Identities: []string{"*"}, Devices: []string{"*"}, Services: []string{"ssh"}, Effect: EffectDeny},
+	}}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		identity  auth.Identity
+		serviceID string
+		want      bool
+	}{
+		{auth.Identity{Name: "demo-user", Method: auth.IdentityMethodBearer}, "demo1", true},
+		// 同名的证书、api key 身份不能获得 bearer token 身份的权限
+		{auth.Identity{Name: "demo-user", Method: auth.IdentityMethodClientCert}, "demo1", false},
+		{auth.Identity{Name: "demo-user", Method: auth.IdentityMethodAPIKey}, "demo1", false},
+		{auth.Identity{Name: "ops", Method: auth.IdentityMethodClientCert}, "demo1", true},
+		{auth.Identity{Name: "ops", Method: auth.IdentityMethodPassword}, "ssh", false},
+		{auth.Identity{}, "demo1", false},
+	} {
+		if got, reason := p.Evaluate(tc.identity, "DEVICE-0000", tc.serviceID); got != tc.want {
+			t.Errorf("Evaluate(%s, %s) = %v (%s), want %v", tc.identity, tc.serviceID, got, reason, tc.want)
+		}
+	}
+}
+
+func TestPolicyValidateIdentityPattern(t *testing.T) {
+	for pattern, ok := range map[string]bool{
+		"bearer:demo-user": true,
+		"*:demo-user":      true,
+		"mtls:ops-*":       true,
+		"anonymous":        true,
+		"*":                true,
+		"demo-user":        false,
+		"demo-*":           false,
+	} {
+		p := &Policy{Rules: []Rule{{Identities: []string{pattern}, Effect: EffectAllow}}}
+		if err := p.Validate(); (err == nil) != ok {
+			t.Errorf("Validate identity pattern %q error = %v, want ok %v", pattern, err, ok)
+		}
+	}
+}
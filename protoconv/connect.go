@@ -0,0 +1,107 @@
+package protoconv
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/auth"
+	"github.com/rectcircle/expose-edge-service-demo/helper"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+	"github.com/rectcircle/expose-edge-service-demo/metrics"
+	"github.com/rectcircle/expose-edge-service-demo/policy"
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
+)
+
+// DefaultConnectHostTemplate http CONNECT 代理虚拟域名的默认模板。设备 ID 可以包含 `-`，按最后一个 `-` 拆分，服务 ID 不能包含 `-`
+const DefaultConnectHostTemplate = "{device}-{service}.edge"
+
+// ConnectProtoConv http CONNECT 代理协议转换服务，用于只能通过 http 代理访问外部的调用方。
+// CONNECT 的目标是虚拟域名（例如 `<device>-<service>.edge:<任意端口>`），按域名模板解析出设备和服务后，
+// 通过 Proxy-Authorization 认证调用方，再将 Hijack 得到的连接通过 access 流程转发。
+type ConnectProtoConv struct {
+	Dialer *AccessDialer
+	// Authorizer 校验调用方是否可以访问目标设备的服务，为 nil 时不校验。
+	// 调用方身份来自 Proxy-Authorization（参见 auth.ProxyAuthorizationResolver）
+	Authorizer policy.Authorizer
+	// RouteCacheTTL 路由查询结果缓存的时间，<= 0 时每个连接都查询路由表
+	RouteCacheTTL time.Duration
+	Logger        *slog.Logger
+
+	hosts  *HostRouteResolver
+	routes *routeCache
+}
+
+var _ http.Handler = &ConnectProtoConv{}
+
+func NewConnectProtoConv(routeTable routetable.RouteTable, hosts *HostRouteResolver) *ConnectProtoConv {
+	return &ConnectProtoConv{
+		Dialer:        &AccessDialer{},
+		RouteCacheTTL: DefaultRouteCacheTTL,
+		Logger:        slog.Default().With(logging.KeyComponent, metrics.ComponentConnectProtoConv),
+		hosts:         hosts,
+		routes:        newRouteCache(routeTable),
+	}
+}
+
+func (p *ConnectProtoConv) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		w.Header().Set("Allow", http.MethodConnect)
+		helper.RespString(w, 405, "method not allowed: only CONNECT is supported")
+		return
+	}
+	// CONNECT 请求的 Host 即目标 host:port
+	route, ok := p.hosts.Match(r.Host)
+	if !ok {
+		helper.RespString(w, 400, "bad request: unknown host "+r.Host)
+		return
+	}
+	edgeDeviceID, edgeServiceID := route.DeviceID, route.ServiceID
+	l := p.Logger.With(logging.KeyDeviceID, edgeDeviceID, logging.KeyServiceID, edgeServiceID, logging.KeyRemoteAddr, r.RemoteAddr)
+	l.Debug("connect", "host", r.Host)
+	if p.Authorizer != nil {
+		identity, err := p.Authorizer.Authorize(r, edgeDeviceID, edgeServiceID)
+		if err != nil {
+			l.Warn("authorize error", "identity", identity.String(), logging.Err(err))
+			metrics.AccessFailed(metrics.ComponentConnectProtoConv, "unauthorized")
+			if errors.Is(err, auth.ErrUnauthenticated) {
+				// 代理使用 407 要求调用方提供 Proxy-Authorization
+				w.Header().Set("Proxy-Authenticate", `Basic realm="edge"`)
+				helper.RespString(w, http.StatusProxyAuthRequired, "proxy authentication required: "+err.Error())
+				return
+			}
+			helper.RespString(w, auth.StatusCode(err), "authorize error: "+err.Error())
+			return
+		}
+		l = l.With("identity", identity.String())
+		l.Debug("authorize success")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		helper.RespString(w, 500, "internal server error: hijack not supported")
+		return
+	}
+	nextConn, err := dialRoute(p.Dialer, p.routes, p.RouteCacheTTL, metrics.ComponentConnectProtoConv, l, edgeDeviceID, edgeServiceID)
+	if err != nil {
+		if errors.Is(err, routetable.ErrNotFound) {
+			helper.RespString(w, 502, "bad gateway: route table not found")
+			return
+		}
+		helper.RespString(w, 502, "bad gateway: "+err.Error())
+		return
+	}
+	defer nextConn.Close()
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		l.Warn("hijack error", logging.Err(err))
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		l.Debug("write connect response error", logging.Err(err))
+		return
+	}
+	// 调用方可能在收到响应前就发送了数据（例如 TLS ClientHello），已经被读入 rw.Reader
+	relayStream(metrics.ComponentConnectProtoConv, l, &helper.BufferedConn{Conn: conn, Reader: rw.Reader}, nextConn)
+}
@@ -0,0 +1,59 @@
+package protoconv
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/rectcircle/expose-edge-service-demo/exposer"
+	"github.com/rectcircle/expose-edge-service-demo/helper"
+)
+
+// AccessDialer 通过 exposer server 的 access 流程，打开到边缘服务的 TCP over websocket 连接
+type AccessDialer struct {
+	// Header 附加到 access 请求上的 header，例如协议转换服务自身的凭证
+	Header http.Header
+	// TLSConfig 不为 nil 时使用 wss:// 连接 exposer server
+	TLSConfig *tls.Config
+}
+
+func (d *AccessDialer) Dial(IPPort, edgeDeviceID, edgeServiceID string) (net.Conn, error) {
+	// 构造 http 路由需要的 header
+	header := http.Header{}
+	for k, v := range d.Header {
+		header[k] = v
+	}
+	header.Set(exposer.EdgeDeviceIDHeaderKey, edgeDeviceID)
+	header.Set(exposer.EdgeServiceIDHeaderKey, edgeServiceID)
+	header.Set(exposer.EdgeFlowTypeHeaderKey, string(exposer.EdgeFlowTypeAccess))
+	// 打开 websocket 连接
+	scheme := "ws://"
+	if d.TLSConfig != nil {
+		scheme = "wss://"
+	}
+	c, resp, err := helper.WebsocketDialer(d.TLSConfig).Dial(scheme+IPPort, header)
+	if err != nil {
+		if resp != nil {
+			// exposer server 拒绝了 access 请求，响应体是原因
+			defer resp.Body.Close()
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			return nil, &AccessError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+		}
+		return nil, err
+	}
+	// 包装成 tcp 连接
+	return &helper.WebsocketConnWrapper{WsConn: c}, nil
+}
+
+// AccessError exposer server 拒绝 access 请求，例如鉴权失败 (401/403)、路由不存在或设备不在线 (502)、正在下线 (503)
+type AccessError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *AccessError) Error() string {
+	return fmt.Sprintf("access rejected by exposer server: %d %s", e.StatusCode, e.Message)
+}
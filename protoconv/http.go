@@ -0,0 +1,87 @@
+package protoconv
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/auth"
+	"github.com/rectcircle/expose-edge-service-demo/exposer"
+	"github.com/rectcircle/expose-edge-service-demo/helper"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+	"github.com/rectcircle/expose-edge-service-demo/metrics"
+	"github.com/rectcircle/expose-edge-service-demo/policy"
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
+)
+
+// HTTPProtoConv http 协议转换服务，根据请求头（或 Host、路径前缀，参见 RouteResolver）将请求转发到对应边缘设备的服务
+type HTTPProtoConv struct {
+	// Resolver 从请求中解析目标设备和服务，默认使用请求头
+	Resolver RouteResolver
+	// Authorizer 校验调用方是否可以访问目标设备的服务，为 nil 时不校验
+	Authorizer policy.Authorizer
+	Dialer     *AccessDialer
+	// IdleConnTimeout 到边缘服务的空闲连接保留的时间，MaxIdleConns 每个 (设备, 服务) 保留的最大空闲连接数
+	IdleConnTimeout time.Duration
+	MaxIdleConns    int
+	Logger          *slog.Logger
+
+	routeTable routetable.RouteTable
+
+	mu         sync.Mutex
+	transports map[string]*edgeTransport // exposer-route-table:<service-id>:<device-id> => 连接池
+	evictOnce  sync.Once
+	closeOnce  sync.Once
+	closeChan  chan struct{}
+}
+
+var _ http.Handler = &HTTPProtoConv{}
+
+func NewHTTPProtoConv(routeTable routetable.RouteTable) *HTTPProtoConv {
+	return &HTTPProtoConv{
+		Resolver:        HeaderRouteResolver{},
+		Dialer:          &AccessDialer{},
+		IdleConnTimeout: DefaultHTTPIdleConnTimeout,
+		MaxIdleConns:    DefaultHTTPMaxIdleConns,
+		Logger:          slog.Default().With(logging.KeyComponent, metrics.ComponentHTTPProtoConv),
+		routeTable:      routeTable,
+		transports:      map[string]*edgeTransport{},
+		closeChan:       make(chan struct{}),
+	}
+}
+
+func (p *HTTPProtoConv) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 解析目标设备和服务
+	httpRoute, ok := p.Resolver.Resolve(r)
+	if !ok {
+		helper.RespString(w, 400, fmt.Sprintf("bad request: unknown host or path, and %s or %s header not exist", exposer.EdgeDeviceIDHeaderKey, exposer.EdgeServiceIDHeaderKey))
+		return
+	}
+	edgeDeviceID, edgeServiceID := httpRoute.DeviceID, httpRoute.ServiceID
+	l := p.Logger.With(logging.KeyDeviceID, edgeDeviceID, logging.KeyServiceID, edgeServiceID, logging.KeyRemoteAddr, r.RemoteAddr)
+	l.Debug("request", "method", r.Method, "path", r.URL.Path)
+	if p.Authorizer != nil {
+		identity, err := p.Authorizer.Authorize(r, edgeDeviceID, edgeServiceID)
+		if err != nil {
+			l.Warn("authorize error", "identity", identity.String(), logging.Err(err))
+			metrics.AccessFailed(metrics.ComponentHTTPProtoConv, "unauthorized")
+			helper.RespString(w, auth.StatusCode(err), "authorize error: "+err.Error())
+			return
+		}
+		l = l.With("identity", identity.String())
+		l.Debug("authorize success")
+		// 调用方凭证不需要透传到边缘 service
+		auth.StripCredential(r, identity)
+	}
+	// 路由信息不需要透传到边缘 service
+	r.Header.Del(exposer.EdgeDeviceIDHeaderKey)
+	r.Header.Del(exposer.EdgeServiceIDHeaderKey)
+	httpRoute.StripPrefix(r)
+	// 复用 (设备, 服务) 的连接池，稳态下请求不需要建立新的 websocket 连接和 access stream
+	t := p.acquireTransport(edgeDeviceID, edgeServiceID)
+	defer t.release()
+	t.proxy.ServeHTTP(w, r)
+	l.Debug("finish")
+}
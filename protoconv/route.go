@@ -0,0 +1,195 @@
+package protoconv
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/rectcircle/expose-edge-service-demo/exposer"
+)
+
+// HTTPRoute http 请求的目标设备和服务
+type HTTPRoute struct {
+	DeviceID  string
+	ServiceID string
+	// Prefix 转发前需要从请求路径中去掉的前缀（转义后的形式），为空时不修改路径
+	Prefix string
+}
+
+// RouteResolver 从 http 请求中解析目标设备和服务，ok 为 false 表示请求中没有该 resolver 关心的路由信息
+type RouteResolver interface {
+	Resolve(r *http.Request) (route HTTPRoute, ok bool)
+}
+
+// ChainRouteResolver 依次尝试多个 RouteResolver，返回第一个解析成功的结果
+type ChainRouteResolver []RouteResolver
+
+var _ RouteResolver = ChainRouteResolver{}
+
+func (c ChainRouteResolver) Resolve(r *http.Request) (HTTPRoute, bool) {
+	for _, resolver := range c {
+		if route, ok := resolver.Resolve(r); ok {
+			return route, true
+		}
+	}
+	return HTTPRoute{}, false
+}
+
+// HeaderRouteResolver 通过 X-Edge-Device-ID 和 X-Edge-Service-ID header 路由
+type HeaderRouteResolver struct{}
+
+var _ RouteResolver = HeaderRouteResolver{}
+
+func (HeaderRouteResolver) Resolve(r *http.Request) (HTTPRoute, bool) {
+	route := HTTPRoute{
+		DeviceID:  r.Header.Get(exposer.EdgeDeviceIDHeaderKey),
+		ServiceID: r.Header.Get(exposer.EdgeServiceIDHeaderKey),
+	}
+	return route, route.DeviceID != "" && route.ServiceID != ""
+}
+
+const (
+	// RouteTemplateDevice、RouteTemplateService 路由模板中设备 ID 和服务 ID 的占位符
+	RouteTemplateDevice  = "{device}"
+	RouteTemplateService = "{service}"
+)
+
+// HostRouteResolver 通过 Host 路由，例如模板 `{service}.{device}.edge.example.com`
+// 将 `demo1.device-0000.edge.example.com` 路由到设备 device-0000 的服务 demo1，配合泛域名解析后浏览器可以直接访问边缘服务。
+// 浏览器会将域名转为小写，设备 ID 和服务 ID 需要是小写才能通过浏览器访问。
+type HostRouteResolver struct {
+	re           *regexp.Regexp
+	deviceIndex  int
+	serviceIndex int
+}
+
+var _ RouteResolver = &HostRouteResolver{}
+
+// NewHostRouteResolver template 中 {device} 和 {service} 需要各出现一次，占位符匹配一个不包含 `.` 的域名标签
+func NewHostRouteResolver(template string) (*HostRouteResolver, error) {
+	re, indexes, err := compileRouteTemplate(template, "[^.]+")
+	if err != nil {
+		return nil, err
+	}
+	return &HostRouteResolver{
+		re:           regexp.MustCompile("(?i)^" + re + "$"),
+		deviceIndex:  indexes[RouteTemplateDevice],
+		serviceIndex: indexes[RouteTemplateService],
+	}, nil
+}
+
+func (h *HostRouteResolver) Resolve(r *http.Request) (HTTPRoute, bool) {
+	return h.Match(r.Host)
+}
+
+// Match 按模板匹配域名，host 可以带端口
+func (h *HostRouteResolver) Match(host string) (HTTPRoute, bool) {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	m := h.re.FindStringSubmatch(strings.TrimSuffix(host, "."))
+	if m == nil {
+		return HTTPRoute{}, false
+	}
+	return HTTPRoute{DeviceID: m[h.deviceIndex], ServiceID: m[h.serviceIndex]}, true
+}
+
+// PathRouteResolver 通过路径前缀路由，例如模板 `/devices/{device}/services/{service}`
+// 将 `/devices/DEVICE-0000/services/demo1/index.html` 路由到设备 DEVICE-0000 的服务 demo1，
+// 转发时去掉前缀，并通过 X-Forwarded-Prefix 告诉边缘服务被去掉的前缀，用于生成正确的链接。
+// 适用于只能转发单个域名的 API 网关。
+type PathRouteResolver struct {
+	re           *regexp.Regexp
+	deviceIndex  int
+	serviceIndex int
+}
+
+var _ RouteResolver = &PathRouteResolver{}
+
+// NewPathRouteResolver template 需要以 / 开头，{device} 和 {service} 需要各出现一次，占位符匹配一个路径段
+func NewPathRouteResolver(template string) (*PathRouteResolver, error) {
+	if !strings.HasPrefix(template, "/") {
+		return nil, fmt.Errorf("route template %q: must start with /", template)
+	}
+	re, indexes, err := compileRouteTemplate(strings.TrimSuffix(template, "/"), "[^/]+")
+	if err != nil {
+		return nil, err
+	}
+	return &PathRouteResolver{
+		re:           regexp.MustCompile("^" + re + "(?:/|$)"),
+		deviceIndex:  indexes[RouteTemplateDevice],
+		serviceIndex: indexes[RouteTemplateService],
+	}, nil
+}
+
+func (p *PathRouteResolver) Resolve(r *http.Request) (HTTPRoute, bool) {
+	path := r.URL.EscapedPath()
+	m := p.re.FindStringSubmatch(path)
+	if m == nil {
+		return HTTPRoute{}, false
+	}
+	deviceID, err1 := url.PathUnescape(m[p.deviceIndex])
+	serviceID, err2 := url.PathUnescape(m[p.serviceIndex])
+	if err1 != nil || err2 != nil {
+		return HTTPRoute{}, false
+	}
+	return HTTPRoute{DeviceID: deviceID, ServiceID: serviceID, Prefix: strings.TrimSuffix(m[0], "/")}, true
+}
+
+// StripPrefix 从请求路径中去掉 route.Prefix，并追加到 X-Forwarded-Prefix（前面的网关可能已经设置）
+func (route HTTPRoute) StripPrefix(r *http.Request) {
+	if route.Prefix == "" {
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.EscapedPath(), route.Prefix)
+	if rest == "" {
+		rest = "/"
+	}
+	path, err := url.PathUnescape(rest)
+	if err != nil {
+		return
+	}
+	r.URL.Path, r.URL.RawPath = path, rest
+	r.Header.Set(ForwardedPrefixHeaderKey, strings.TrimSuffix(r.Header.Get(ForwardedPrefixHeaderKey), "/")+route.Prefix)
+}
+
+// ForwardedPrefixHeaderKey 按路径前缀路由时，被去掉的前缀
+const ForwardedPrefixHeaderKey = "X-Forwarded-Prefix"
+
+// compileRouteTemplate 将模板转换为正则表达式（不包含首尾的锚点），占位符匹配 placeholder，
+// 返回占位符对应的子匹配序号
+func compileRouteTemplate(template, placeholder string) (string, map[string]int, error) {
+	indexes := map[string]int{}
+	var sb strings.Builder
+	rest := template
+	for rest != "" {
+		i := strings.Index(rest, "{")
+		if i < 0 {
+			sb.WriteString(regexp.QuoteMeta(rest))
+			break
+		}
+		sb.WriteString(regexp.QuoteMeta(rest[:i]))
+		rest = rest[i:]
+		j := strings.Index(rest, "}")
+		if j < 0 {
+			return "", nil, fmt.Errorf("route template %q: unclosed {", template)
+		}
+		name := rest[:j+1]
+		if name != RouteTemplateDevice && name != RouteTemplateService {
+			return "", nil, fmt.Errorf("route template %q: unknown placeholder %s, want %s or %s", template, name, RouteTemplateDevice, RouteTemplateService)
+		}
+		if _, ok := indexes[name]; ok {
+			return "", nil, fmt.Errorf("route template %q: duplicate placeholder %s", template, name)
+		}
+		indexes[name] = len(indexes) + 1
+		sb.WriteString("(" + placeholder + ")")
+		rest = rest[j+1:]
+	}
+	if len(indexes) != 2 {
+		return "", nil, fmt.Errorf("route template %q: must contain both %s and %s", template, RouteTemplateDevice, RouteTemplateService)
+	}
+	return sb.String(), indexes, nil
+}
@@ -0,0 +1,151 @@
+package protoconv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rectcircle/expose-edge-service-demo/exposer"
+)
+
+func TestHostRouteResolver(t *testing.T) {
+	h, err := NewHostRouteResolver("{service}.{device}.edge.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		host string
+		want HTTPRoute
+		ok   bool
+	}{
+		{"demo1.device-0000.edge.example.com", HTTPRoute{DeviceID: "device-0000", ServiceID: "demo1"}, true},
+		{"demo1.device-0000.edge.example.com:8080", HTTPRoute{DeviceID: "device-0000", ServiceID: "demo1"}, true},
+		{"demo1.device-0000.edge.example.com.", HTTPRoute{DeviceID: "device-0000", ServiceID: "demo1"}, true},
+		{"Demo1.DEVICE-0000.Edge.Example.COM", HTTPRoute{DeviceID: "DEVICE-0000", ServiceID: "Demo1"}, true},
+		// 占位符只匹配一个域名标签，包含 `.` 的 ID 不能通过 Host 路由
+		{"demo.v1.device-0000.edge.example.com", HTTPRoute{}, false},
+		{"demo1.edge.example.com", HTTPRoute{}, false},
+		{"demo1.device-0000.edge.example.com.evil.com", HTTPRoute{}, false},
+		{"demo1.device-0000.edge.example.org", HTTPRoute{}, false},
+		{"demo1.device-0000xedgexexample.com", HTTPRoute{}, false},
+		{"localhost:9100", HTTPRoute{}, false},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Host = tc.host
+		got, ok := h.Resolve(r)
+		if ok != tc.ok || got != tc.want {
+			t.Errorf("Resolve(%q) = %+v, %v; want %+v, %v", tc.host, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestPathRouteResolver(t *testing.T) {
+	for _, template := range []string{"/devices/{device}/services/{service}", "/devices/{device}/services/{service}/"} {
+		p, err := NewPathRouteResolver(template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tc := range []struct {
+			path string
+			want HTTPRoute
+			ok   bool
+		}{
+			{"/devices/DEVICE-0000/services/demo1/index.html", HTTPRoute{DeviceID: "DEVICE-0000", ServiceID: "demo1", Prefix: "/devices/DEVICE-0000/services/demo1"}, true},
+			{"/devices/DEVICE-0000/services/demo1", HTTPRoute{DeviceID: "DEVICE-0000", ServiceID: "demo1", Prefix: "/devices/DEVICE-0000/services/demo1"}, true},
+			{"/devices/DEVICE-0000/services/demo1/", HTTPRoute{DeviceID: "DEVICE-0000", ServiceID: "demo1", Prefix: "/devices/DEVICE-0000/services/demo1"}, true},
+			// 路径段中可以包含 `.`
+			{"/devices/device.0000/services/demo.v1/a.txt", HTTPRoute{DeviceID: "device.0000", ServiceID: "demo.v1", Prefix: "/devices/device.0000/services/demo.v1"}, true},
+			// 转义的 `/` 属于同一个路径段，Prefix 保持转义后的形式
+			{"/devices/DEVICE%2F0000/services/demo1/x", HTTPRoute{DeviceID: "DEVICE/0000", ServiceID: "demo1", Prefix: "/devices/DEVICE%2F0000/services/demo1"}, true},
+			{"/devices/DEVICE-0000/services", HTTPRoute{}, false},
+			{"/devices/DEVICE-0000/services/", HTTPRoute{}, false},
+			{"/devices//services/demo1", HTTPRoute{}, false},
+			{"/api/devices/DEVICE-0000/services/demo1", HTTPRoute{}, false},
+			{"/", HTTPRoute{}, false},
+		} {
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			got, ok := p.Resolve(r)
+			if ok != tc.ok || got != tc.want {
+				t.Errorf("template %q: Resolve(%q) = %+v, %v; want %+v, %v", template, tc.path, got, ok, tc.want, tc.ok)
+			}
+		}
+	}
+	if _, err := NewPathRouteResolver("devices/{device}/services/{service}"); err == nil {
+		t.Error("template without leading / want error")
+	}
+}
+
+func TestStripPrefix(t *testing.T) {
+	for _, tc := range []struct {
+		target        string
+		prefix        string
+		forwarded     string
+		wantPath      string
+		wantRawPath   string
+		wantForwarded string
+		wantQuery     string
+	}{
+		{"/devices/D/services/demo1/index.html?a=1", "/devices/D/services/demo1", "", "/index.html", "/index.html", "/devices/D/services/demo1", "a=1"},
+		{"/devices/D/services/demo1", "/devices/D/services/demo1", "", "/", "/", "/devices/D/services/demo1", ""},
+		{"/devices/D/services/demo1/", "/devices/D/services/demo1", "", "/", "/", "/devices/D/services/demo1", ""},
+		// 前面的网关已经去掉了一段前缀
+		{"/devices/D/services/demo1/a", "/devices/D/services/demo1", "/gateway/", "/a", "/a", "/gateway/devices/D/services/demo1", ""},
+		{"/devices/D%2F1/services/demo1/a%2Fb", "/devices/D%2F1/services/demo1", "", "/a/b", "/a%2Fb", "/devices/D%2F1/services/demo1", ""},
+	} {
+		r := httptest.NewRequest(http.MethodGet, tc.target, nil)
+		if tc.forwarded != "" {
+			r.Header.Set(ForwardedPrefixHeaderKey, tc.forwarded)
+		}
+		HTTPRoute{Prefix: tc.prefix}.StripPrefix(r)
+		if r.URL.Path != tc.wantPath || r.URL.EscapedPath() != tc.wantRawPath || r.URL.RawQuery != tc.wantQuery {
+			t.Errorf("StripPrefix(%q) path = %q (%q) query %q; want %q (%q) query %q", tc.target, r.URL.Path, r.URL.EscapedPath(), r.URL.RawQuery, tc.wantPath, tc.wantRawPath, tc.wantQuery)
+		}
+		if got := r.Header.Get(ForwardedPrefixHeaderKey); got != tc.wantForwarded {
+			t.Errorf("StripPrefix(%q) %s = %q, want %q", tc.target, ForwardedPrefixHeaderKey, got, tc.wantForwarded)
+		}
+	}
+
+	// 没有前缀时不修改请求
+	r := httptest.NewRequest(http.MethodGet, "/index.html", nil)
+	HTTPRoute{}.StripPrefix(r)
+	if r.URL.Path != "/index.html" || r.Header.Get(ForwardedPrefixHeaderKey) != "" {
+		t.Fatalf("StripPrefix without prefix changed request: %q, %q", r.URL.Path, r.Header.Get(ForwardedPrefixHeaderKey))
+	}
+}
+
+func TestRouteTemplateErrors(t *testing.T) {
+	for _, template := range []string{
+		"{device}.edge.example.com",
+		"{service}.{device}.{device}.example.com",
+		"{service}.{node}.edge.example.com",
+		"{service}.{device.edge.example.com",
+	} {
+		if _, err := NewHostRouteResolver(template); err == nil {
+			t.Errorf("NewHostRouteResolver(%q) want error", template)
+		}
+	}
+}
+
+func TestChainRouteResolverHeaderFallback(t *testing.T) {
+	h, err := NewHostRouteResolver("{service}.{device}.edge.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := ChainRouteResolver{h, HeaderRouteResolver{}}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Host = "demo1.device-0000.edge.example.com"
+	r.Header.Set(exposer.EdgeDeviceIDHeaderKey, "DEVICE-0001")
+	r.Header.Set(exposer.EdgeServiceIDHeaderKey, "demo2")
+	if got, ok := chain.Resolve(r); !ok || got != (HTTPRoute{DeviceID: "device-0000", ServiceID: "demo1"}) {
+		t.Fatalf("Resolve by host = %+v, %v", got, ok)
+	}
+	r.Host = "localhost:9100"
+	if got, ok := chain.Resolve(r); !ok || got != (HTTPRoute{DeviceID: "DEVICE-0001", ServiceID: "demo2"}) {
+		t.Fatalf("Resolve by header = %+v, %v", got, ok)
+	}
+	r.Header.Del(exposer.EdgeServiceIDHeaderKey)
+	if got, ok := chain.Resolve(r); ok {
+		t.Fatalf("Resolve without route = %+v, want no match", got)
+	}
+}
@@ -0,0 +1,63 @@
+package protoconv
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/helper"
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
+)
+
+// DefaultRouteCacheTTL 路由查询结果缓存的时间。设备重连到其他 exposer server 后，
+// 最多经过该时间新的连接就会使用新的路由（连接旧路由失败时会立即清除缓存）
+const DefaultRouteCacheTTL = 5 * time.Second
+
+// routeCache 缓存路由查询结果，避免每个连接都查询一次路由表。只缓存查询成功的结果
+type routeCache struct {
+	routeTable routetable.RouteTable
+
+	mu      sync.Mutex
+	entries map[string]routeCacheEntry // exposer-route-table:<service-id>:<device-id> => 路由
+}
+
+type routeCacheEntry struct {
+	route   routetable.Route
+	expires time.Time
+}
+
+func newRouteCache(routeTable routetable.RouteTable) *routeCache {
+	return &routeCache{routeTable: routeTable, entries: map[string]routeCacheEntry{}}
+}
+
+// lookup 查询路由，ttl <= 0 时不使用缓存
+func (c *routeCache) lookup(edgeServiceID, edgeDeviceID string, ttl time.Duration) (routetable.Route, error) {
+	key := helper.RouteKey(edgeServiceID, edgeDeviceID)
+	now := time.Now()
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && now.After(entry.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.mu.Unlock()
+	if ok && ttl > 0 {
+		return entry.route, nil
+	}
+	route, err := c.routeTable.Lookup(edgeServiceID, edgeDeviceID)
+	if err != nil {
+		c.invalidate(edgeServiceID, edgeDeviceID)
+		return route, err
+	}
+	if ttl > 0 {
+		c.mu.Lock()
+		c.entries[key] = routeCacheEntry{route: route, expires: now.Add(ttl)}
+		c.mu.Unlock()
+	}
+	return route, nil
+}
+
+func (c *routeCache) invalidate(edgeServiceID, edgeDeviceID string) {
+	c.mu.Lock()
+	delete(c.entries, helper.RouteKey(edgeServiceID, edgeDeviceID))
+	c.mu.Unlock()
+}
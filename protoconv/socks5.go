@@ -0,0 +1,260 @@
+package protoconv
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/auth"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+	"github.com/rectcircle/expose-edge-service-demo/metrics"
+	"github.com/rectcircle/expose-edge-service-demo/policy"
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
+)
+
+// DefaultSOCKS5HostTemplate SOCKS5 虚拟域名的默认模板
+const DefaultSOCKS5HostTemplate = "{service}.{device}.edge"
+
+// socks5HandshakeTimeout 完成 SOCKS5 协商的超时时间
+const socks5HandshakeTimeout = 10 * time.Second
+
+// SOCKS5 协议常量，参见 RFC 1928 和 RFC 1929
+const (
+	socks5Version          = 0x05
+	socks5AuthNone         = 0x00
+	socks5AuthPassword     = 0x02
+	socks5AuthNoAcceptable = 0xff
+	socks5PasswordVersion  = 0x01
+	socks5CmdConnect       = 0x01
+	socks5AtypIPv4         = 0x01
+	socks5AtypDomain       = 0x03
+	socks5AtypIPv6         = 0x04
+
+	socks5RepSucceeded        = 0x00
+	socks5RepGeneralFailure   = 0x01
+	socks5RepNotAllowed       = 0x02
+	socks5RepHostUnreachable  = 0x04
+	socks5RepCmdNotSupported  = 0x07
+	socks5RepAtypNotSupported = 0x08
+)
+
+// SOCKS5ProtoConv SOCKS5 协议转换服务。CONNECT 的目标是虚拟域名（例如 `<service>.<device>.edge:<任意端口>`），
+// 按域名模板解析出设备和服务后，通过 access 流程转发。开发者只需要给 ssh、psql、浏览器等工具配置代理，
+// 不需要为每个设备分配端口。只支持 CONNECT 命令和域名类型的地址。
+type SOCKS5ProtoConv struct {
+	Dialer *AccessDialer
+	// Passwords 用户名密码认证（RFC 1929），用户名即调用方身份。
+	// 为 nil 时不要求认证，任何能连接监听端口的调用方都以 anonymous 身份交给 Authorizer 决策
+	Passwords *auth.PasswordStore
+	// Authorizer 校验调用方是否可以访问目标设备的服务，为 nil 时不校验
+	Authorizer policy.IdentityAuthorizer
+	// RouteCacheTTL 路由查询结果缓存的时间，<= 0 时每个连接都查询路由表
+	RouteCacheTTL time.Duration
+	Logger        *slog.Logger
+
+	hosts  *HostRouteResolver
+	routes *routeCache
+}
+
+func NewSOCKS5ProtoConv(routeTable routetable.RouteTable, hosts *HostRouteResolver) *SOCKS5ProtoConv {
+	return &SOCKS5ProtoConv{
+		Dialer:        &AccessDialer{},
+		RouteCacheTTL: DefaultRouteCacheTTL,
+		Logger:        slog.Default().With(logging.KeyComponent, metrics.ComponentSOCKS5ProtoConv),
+		hosts:         hosts,
+		routes:        newRouteCache(routeTable),
+	}
+}
+
+// Serve 接受 listen 上的连接并处理，listen 关闭后返回
+func (p *SOCKS5ProtoConv) Serve(listen net.Listener) error {
+	for {
+		conn, err := listen.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+		go p.serveConn(conn)
+	}
+}
+
+func (p *SOCKS5ProtoConv) serveConn(conn net.Conn) {
+	defer conn.Close()
+	l := p.Logger.With(logging.KeyRemoteAddr, conn.RemoteAddr().String())
+	_ = conn.SetDeadline(time.Now().Add(socks5HandshakeTimeout))
+	identity, err := p.negotiate(conn)
+	if err != nil {
+		l.Warn("socks5 negotiate error", logging.Err(err))
+		return
+	}
+	host, err := readSOCKS5Request(conn)
+	if err != nil {
+		l.Warn("socks5 request error", logging.Err(err))
+		var repErr socks5ReplyError
+		if errors.As(err, &repErr) {
+			writeSOCKS5Reply(conn, byte(repErr))
+		}
+		return
+	}
+	route, ok := p.hosts.Match(host)
+	if !ok {
+		l.Warn("socks5 unknown host", "host", host)
+		writeSOCKS5Reply(conn, socks5RepHostUnreachable)
+		return
+	}
+	edgeDeviceID, edgeServiceID := route.DeviceID, route.ServiceID
+	l = l.With(logging.KeyDeviceID, edgeDeviceID, logging.KeyServiceID, edgeServiceID, "identity", identity.String())
+	if p.Authorizer != nil {
+		if err := p.Authorizer.AuthorizeIdentity(identity, conn.RemoteAddr().String(), edgeDeviceID, edgeServiceID); err != nil {
+			l.Warn("authorize error", logging.Err(err))
+			metrics.AccessFailed(metrics.ComponentSOCKS5ProtoConv, "unauthorized")
+			writeSOCKS5Reply(conn, socks5RepNotAllowed)
+			return
+		}
+	}
+	nextConn, err := dialRoute(p.Dialer, p.routes, p.RouteCacheTTL, metrics.ComponentSOCKS5ProtoConv, l, edgeDeviceID, edgeServiceID)
+	if err != nil {
+		rep := byte(socks5RepGeneralFailure)
+		if errors.Is(err, routetable.ErrNotFound) {
+			rep = socks5RepHostUnreachable
+		}
+		writeSOCKS5Reply(conn, rep)
+		return
+	}
+	defer nextConn.Close()
+	if err := writeSOCKS5Reply(conn, socks5RepSucceeded); err != nil {
+		l.Debug("write socks5 reply error", logging.Err(err))
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+	relayStream(metrics.ComponentSOCKS5ProtoConv, l, conn, nextConn)
+}
+
+// negotiate 协商认证方式并认证，返回调用方身份
+func (p *SOCKS5ProtoConv) negotiate(conn net.Conn) (auth.Identity, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return auth.Identity{}, err
+	}
+	if head[0] != socks5Version {
+		return auth.Identity{}, fmt.Errorf("unsupported socks version %d", head[0])
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return auth.Identity{}, err
+	}
+	want := byte(socks5AuthNone)
+	if p.Passwords != nil {
+		want = socks5AuthPassword
+	}
+	found := false
+	for _, m := range methods {
+		found = found || m == want
+	}
+	if !found {
+		_, _ = conn.Write([]byte{socks5Version, socks5AuthNoAcceptable})
+		return auth.Identity{}, fmt.Errorf("no acceptable auth method, want %d", want)
+	}
+	if _, err := conn.Write([]byte{socks5Version, want}); err != nil {
+		return auth.Identity{}, err
+	}
+	if p.Passwords == nil {
+		return auth.Identity{}, nil
+	}
+	// RFC 1929: VER ULEN UNAME PLEN PASSWD
+	username, password, err := readSOCKS5Password(conn)
+	if err != nil {
+		return auth.Identity{}, err
+	}
+	identity, err := p.Passwords.Verify(username, password)
+	if err != nil {
+		_, _ = conn.Write([]byte{socks5PasswordVersion, 0x01})
+		return identity, err
+	}
+	_, err = conn.Write([]byte{socks5PasswordVersion, 0x00})
+	return identity, err
+}
+
+func readSOCKS5Password(r io.Reader) (username, password string, err error) {
+	var ver [1]byte
+	if _, err := io.ReadFull(r, ver[:]); err != nil {
+		return "", "", err
+	}
+	if ver[0] != socks5PasswordVersion {
+		return "", "", fmt.Errorf("unsupported password auth version %d", ver[0])
+	}
+	if username, err = readSOCKS5String(r); err != nil {
+		return "", "", err
+	}
+	password, err = readSOCKS5String(r)
+	return username, password, err
+}
+
+// readSOCKS5String 读取一个字节的长度和随后的字符串
+func readSOCKS5String(r io.Reader) (string, error) {
+	var size [1]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return "", err
+	}
+	buf := make([]byte, size[0])
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// socks5ReplyError 需要以对应的 REP 回复调用方的请求错误
+type socks5ReplyError byte
+
+func (e socks5ReplyError) Error() string {
+	return "socks5 reply " + strconv.Itoa(int(e))
+}
+
+// readSOCKS5Request 读取请求 (VER CMD RSV ATYP DST.ADDR DST.PORT)，返回目标 host:port，端口不参与路由
+func readSOCKS5Request(r io.Reader) (string, error) {
+	var head [4]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return "", err
+	}
+	if head[0] != socks5Version {
+		return "", fmt.Errorf("unsupported socks version %d", head[0])
+	}
+	if head[1] != socks5CmdConnect {
+		return "", fmt.Errorf("%w: unsupported command %d", socks5ReplyError(socks5RepCmdNotSupported), head[1])
+	}
+	var host string
+	switch head[3] {
+	case socks5AtypDomain:
+		var err error
+		if host, err = readSOCKS5String(r); err != nil {
+			return "", err
+		}
+		if host == "" {
+			return "", fmt.Errorf("%w: empty domain name", socks5ReplyError(socks5RepHostUnreachable))
+		}
+	case socks5AtypIPv4, socks5AtypIPv6:
+		// ip 地址无法对应到边缘服务，调用方需要让代理解析域名（例如 socks5h://）
+		return "", fmt.Errorf("%w: ip address not supported, use a hostname", socks5ReplyError(socks5RepAtypNotSupported))
+	default:
+		return "", fmt.Errorf("%w: unknown address type %d", socks5ReplyError(socks5RepAtypNotSupported), head[3])
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(r, port[:]); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
+
+// writeSOCKS5Reply 回复请求结果，绑定地址总是 0.0.0.0:0
+func writeSOCKS5Reply(w io.Writer, rep byte) error {
+	_, err := w.Write([]byte{socks5Version, rep, 0x00, socks5AtypIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
@@ -0,0 +1,212 @@
+package protoconv
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/rectcircle/expose-edge-service-demo/auth"
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
+)
+
+func TestReadSOCKS5Request(t *testing.T) {
+	domain := func(host string) []byte {
+		return append(append([]byte{socks5Version, socks5CmdConnect, 0x00, socks5AtypDomain, byte(len(host))}, host...), 0x1f, 0x90)
+	}
+	valid := domain("demo1.DEVICE-0000.edge")
+	for _, tc := range []struct {
+		name    string
+		req     []byte
+		want    string
+		wantRep int // -1 表示不是 socks5ReplyError
+	}{
+		{"Domain", valid, "demo1.DEVICE-0000.edge:8080", 0},
+		{"ShortHead", valid[:3], "", -1},
+		{"ShortDomain", valid[:10], "", -1},
+		{"ShortPort", valid[:len(valid)-1], "", -1},
+		{"EmptyDomain", domain(""), "", socks5RepHostUnreachable},
+		{"BadVersion", append([]byte{0x04}, valid[1:]...), "", -1},
+		{"Bind", append([]byte{socks5Version, 0x02}, valid[2:]...), "", socks5RepCmdNotSupported},
+		{"UDPAssociate", append([]byte{socks5Version, 0x03}, valid[2:]...), "", socks5RepCmdNotSupported},
+		{"IPv4", []byte{socks5Version, socks5CmdConnect, 0x00, socks5AtypIPv4, 127, 0, 0, 1, 0x1f, 0x90}, "", socks5RepAtypNotSupported},
+		{"IPv6", append([]byte{socks5Version, socks5CmdConnect, 0x00, socks5AtypIPv6}, make([]byte, 18)...), "", socks5RepAtypNotSupported},
+		{"UnknownAtyp", []byte{socks5Version, socks5CmdConnect, 0x00, 0x05}, "", socks5RepAtypNotSupported},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := readSOCKS5Request(bytes.NewReader(tc.req))
+			if tc.wantRep == 0 {
+				if err != nil || got != tc.want {
+					t.Fatalf("readSOCKS5Request = %q, %v; want %q", got, err, tc.want)
+				}
+				return
+			}
+			var repErr socks5ReplyError
+			switch {
+			case err == nil:
+				t.Fatalf("readSOCKS5Request = %q, want error", got)
+			case tc.wantRep < 0 && errors.As(err, &repErr):
+				t.Fatalf("readSOCKS5Request error = %v, want non reply error", err)
+			case tc.wantRep > 0 && (!errors.As(err, &repErr) || int(repErr) != tc.wantRep):
+				t.Fatalf("readSOCKS5Request error = %v, want reply %d", err, tc.wantRep)
+			}
+		})
+	}
+}
+
+// socks5Negotiate 在 net.Pipe 上运行 negotiate，client 模拟调用方
+func socks5Negotiate(t *testing.T, p *SOCKS5ProtoConv, client func(conn net.Conn)) (auth.Identity, error) {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer clientConn.Close()
+		client(clientConn)
+	}()
+	identity, err := p.negotiate(serverConn)
+	serverConn.Close()
+	<-done
+	return identity, err
+}
+
+// expectRead 读取 n 个字节并与 want 比较
+func expectRead(t *testing.T, conn net.Conn, want []byte) {
+	t.Helper()
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Errorf("read reply: %v", err)
+		return
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("reply = %v, want %v", got, want)
+	}
+}
+
+func TestSOCKS5Negotiate(t *testing.T) {
+	noAuth := NewSOCKS5ProtoConv(routetable.NewMemoryRouteTable(), nil)
+	withPassword := NewSOCKS5ProtoConv(routetable.NewMemoryRouteTable(), nil)
+	withPassword.Passwords = &auth.PasswordStore{Passwords: map[string]string{"demo-user": "demo-password"}}
+	passwordAuth := func(username, password string) []byte {
+		b := append([]byte{socks5PasswordVersion, byte(len(username))}, username...)
+		return append(append(b, byte(len(password))), password...)
+	}
+
+	t.Run("NoAuth", func(t *testing.T) {
+		identity, err := socks5Negotiate(t, noAuth, func(conn net.Conn) {
+			conn.Write([]byte{socks5Version, 2, socks5AuthPassword, socks5AuthNone})
+			expectRead(t, conn, []byte{socks5Version, socks5AuthNone})
+		})
+		if err != nil || identity != (auth.Identity{}) {
+			t.Fatalf("negotiate = %+v, %v; want anonymous", identity, err)
+		}
+	})
+
+	t.Run("EmptyMethods", func(t *testing.T) {
+		_, err := socks5Negotiate(t, noAuth, func(conn net.Conn) {
+			conn.Write([]byte{socks5Version, 0})
+			expectRead(t, conn, []byte{socks5Version, socks5AuthNoAcceptable})
+		})
+		if err == nil {
+			t.Fatal("negotiate with empty method list want error")
+		}
+	})
+
+	t.Run("PasswordRequired", func(t *testing.T) {
+		_, err := socks5Negotiate(t, withPassword, func(conn net.Conn) {
+			conn.Write([]byte{socks5Version, 1, socks5AuthNone})
+			expectRead(t, conn, []byte{socks5Version, socks5AuthNoAcceptable})
+		})
+		if err == nil {
+			t.Fatal("negotiate without password method want error")
+		}
+	})
+
+	t.Run("Password", func(t *testing.T) {
+		identity, err := socks5Negotiate(t, withPassword, func(conn net.Conn) {
+			conn.Write([]byte{socks5Version, 1, socks5AuthPassword})
+			expectRead(t, conn, []byte{socks5Version, socks5AuthPassword})
+			conn.Write(passwordAuth("demo-user", "demo-password"))
+			expectRead(t, conn, []byte{socks5PasswordVersion, 0x00})
+		})
+		if want := (auth.Identity{Name: "demo-user", Method: auth.IdentityMethodPassword}); err != nil || identity != want {
+			t.Fatalf("negotiate = %+v, %v; want %+v", identity, err, want)
+		}
+	})
+
+	t.Run("WrongPassword", func(t *testing.T) {
+		_, err := socks5Negotiate(t, withPassword, func(conn net.Conn) {
+			conn.Write([]byte{socks5Version, 1, socks5AuthPassword})
+			expectRead(t, conn, []byte{socks5Version, socks5AuthPassword})
+			conn.Write(passwordAuth("demo-user", "wrong"))
+			expectRead(t, conn, []byte{socks5PasswordVersion, 0x01})
+		})
+		if !errors.Is(err, auth.ErrUnauthenticated) {
+			t.Fatalf("negotiate error = %v, want ErrUnauthenticated", err)
+		}
+	})
+
+	for name, req := range map[string][]byte{
+		"ShortGreeting":    {socks5Version},
+		"ShortMethods":     {socks5Version, 2, socks5AuthNone},
+		"BadVersion":       {0x04, 1, socks5AuthNone},
+		"ShortPasswordLen": {socks5Version, 1, socks5AuthPassword, socks5PasswordVersion, 9, 'd', 'e'},
+	} {
+		req := req
+		t.Run(name, func(t *testing.T) {
+			p := noAuth
+			if req[len(req)-1] != socks5AuthNone || name == "ShortPasswordLen" {
+				p = withPassword
+			}
+			_, err := socks5Negotiate(t, p, func(conn net.Conn) {
+				// 丢弃可能的回复，请求写完后关闭连接（net.Pipe 没有缓冲）
+				go io.Copy(io.Discard, conn)
+				conn.Write(req)
+			})
+			if err == nil {
+				t.Fatal("negotiate want error")
+			}
+		})
+	}
+}
+
+func TestSOCKS5ServeConnReplies(t *testing.T) {
+	hosts, err := NewHostRouteResolver(DefaultSOCKS5HostTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewSOCKS5ProtoConv(routetable.NewMemoryRouteTable(), hosts)
+	p.RouteCacheTTL = 0
+	connect := func(cmd byte, host string) []byte {
+		return append(append([]byte{socks5Version, cmd, 0x00, socks5AtypDomain, byte(len(host))}, host...), 0x00, 0x16)
+	}
+	for _, tc := range []struct {
+		name string
+		req  []byte
+		rep  byte
+	}{
+		{"UnsupportedCommand", connect(0x02, "demo1.DEVICE-0000.edge"), socks5RepCmdNotSupported},
+		{"EmptyDomain", connect(socks5CmdConnect, ""), socks5RepHostUnreachable},
+		{"UnknownHost", connect(socks5CmdConnect, "example.com"), socks5RepHostUnreachable},
+		{"RouteNotFound", connect(socks5CmdConnect, "demo1.DEVICE-0000.edge"), socks5RepHostUnreachable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			serverConn, clientConn := net.Pipe()
+			defer clientConn.Close()
+			go p.serveConn(serverConn)
+			clientConn.Write([]byte{socks5Version, 1, socks5AuthNone})
+			expectRead(t, clientConn, []byte{socks5Version, socks5AuthNone})
+			// 出错时服务端不会读完请求，net.Pipe 没有缓冲
+			go clientConn.Write(tc.req)
+			reply, err := io.ReadAll(clientConn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(reply) < 2 || reply[1] != tc.rep {
+				t.Fatalf("reply = %v, want REP %d", reply, tc.rep)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package protoconv
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/helper"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+	"github.com/rectcircle/expose-edge-service-demo/metrics"
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
+)
+
+// tcp、socks5 等面向流的协议转换服务共用的转发逻辑
+
+// dialRoute 查询路由（带缓存）并打开 access 连接，失败时记录 component 的指标。
+// 连接 exposer server 失败时清除缓存的路由，下一个连接重新查询。
+func dialRoute(d *AccessDialer, routes *routeCache, ttl time.Duration, component string, l *slog.Logger, edgeDeviceID, edgeServiceID string) (net.Conn, error) {
+	route, err := routes.lookup(edgeServiceID, edgeDeviceID, ttl)
+	if err != nil {
+		reason := "route_table"
+		if errors.Is(err, routetable.ErrNotFound) {
+			reason = "route_not_found"
+		}
+		l.Warn("query route table error", logging.Err(err))
+		metrics.AccessFailed(component, reason)
+		return nil, err
+	}
+	IPPort := route.Addr
+	nextConn, err := d.Dial(IPPort, edgeDeviceID, edgeServiceID)
+	if err != nil {
+		routes.invalidate(edgeServiceID, edgeDeviceID)
+		l.Warn("connect to exposer server error", "addr", IPPort, logging.Err(err))
+		metrics.AccessFailed(component, "dial")
+		return nil, err
+	}
+	l.Debug("connect to exposer server success", "addr", IPPort)
+	metrics.AccessOpened(component, edgeDeviceID, edgeServiceID)
+	return nextConn, nil
+}
+
+// relayStream 在调用方连接 conn 和 access 连接 nextConn 之间双向转发，直到任意一方关闭
+func relayStream(component string, l *slog.Logger, conn, nextConn net.Conn) {
+	err := helper.IORelayCounted(nextConn, conn,
+		metrics.RelayCounter(component, metrics.DirectionToEdge),
+		metrics.RelayCounter(component, metrics.DirectionFromEdge))
+	if err != nil {
+		l.Debug("proxy IORelay error", logging.Err(err))
+		return
+	}
+	l.Debug("proxy finish")
+}
+
+// refuse 以 RST 关闭连接，调用方可以立即感知到连接被拒绝
+func refuse(conn net.Conn) {
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		_ = tcpConn.SetLinger(0)
+	}
+	_ = conn.Close()
+}
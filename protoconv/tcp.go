@@ -0,0 +1,177 @@
+package protoconv
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+	"github.com/rectcircle/expose-edge-service-demo/metrics"
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
+)
+
+// ErrListenerExists 端口已经在监听
+var ErrListenerExists = errors.New("listener already exists")
+
+// TCPListener 监听表中的一项：本地端口上的 tcp 连接转发到某个边缘设备的某个服务
+type TCPListener struct {
+	Port      int
+	DeviceID  string
+	ServiceID string
+}
+
+// TCPProtoConv tcp 协议转换服务，按监听表将多个本地端口上的 tcp 连接转发到对应边缘设备的服务。
+// 每个连接查询一次路由（带短暂的缓存），设备重连到其他 exposer server 后新的连接使用新的路由；
+// 路由不存在或 exposer server 不可达时拒绝该连接。监听表可以在运行时修改。
+type TCPProtoConv struct {
+	Dialer *AccessDialer
+	// RouteCacheTTL 路由查询结果缓存的时间，<= 0 时每个连接都查询路由表
+	RouteCacheTTL time.Duration
+	Logger        *slog.Logger
+
+	routes *routeCache
+
+	mu        sync.Mutex
+	listeners map[int]*tcpListener // 端口 => 监听
+}
+
+type tcpListener struct {
+	spec   TCPListener // 受 TCPProtoConv.mu 保护，修改目标设备和服务时不需要重新监听
+	listen net.Listener
+}
+
+func NewTCPProtoConv(routeTable routetable.RouteTable) *TCPProtoConv {
+	return &TCPProtoConv{
+		Dialer:        &AccessDialer{},
+		RouteCacheTTL: DefaultRouteCacheTTL,
+		Logger:        slog.Default().With(logging.KeyComponent, metrics.ComponentTCPProtoConv),
+		routes:        newRouteCache(routeTable),
+		listeners:     map[int]*tcpListener{},
+	}
+}
+
+// Add 监听 spec.Port，端口已经在监听时返回 ErrListenerExists
+func (p *TCPProtoConv) Add(spec TCPListener) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.listeners[spec.Port]; ok {
+		return fmt.Errorf("%w: port %d", ErrListenerExists, spec.Port)
+	}
+	listen, err := net.Listen("tcp", fmt.Sprintf(":%d", spec.Port))
+	if err != nil {
+		return err
+	}
+	tl := &tcpListener{spec: spec, listen: listen}
+	p.listeners[spec.Port] = tl
+	p.Logger.Info("listening", "port", spec.Port, logging.KeyDeviceID, spec.DeviceID, logging.KeyServiceID, spec.ServiceID)
+	go p.serve(tl)
+	return nil
+}
+
+// Remove 停止监听 port，已经建立的连接不受影响
+func (p *TCPProtoConv) Remove(port int) bool {
+	p.mu.Lock()
+	tl, ok := p.listeners[port]
+	delete(p.listeners, port)
+	p.mu.Unlock()
+	if ok {
+		_ = tl.listen.Close()
+		p.Logger.Info("stop listening", "port", port)
+	}
+	return ok
+}
+
+// Apply 将监听表调整为 specs：监听新增的端口，停止已删除的端口，目标变化的端口原地修改（只影响之后的连接）。
+// 监听失败的端口会跳过，错误合并返回。
+func (p *TCPProtoConv) Apply(specs []TCPListener) (added, removed, changed []int, err error) {
+	want := make(map[int]TCPListener, len(specs))
+	for _, spec := range specs {
+		want[spec.Port] = spec
+	}
+	p.mu.Lock()
+	for port, tl := range p.listeners {
+		spec, ok := want[port]
+		if !ok {
+			removed = append(removed, port)
+			continue
+		}
+		if spec != tl.spec {
+			tl.spec = spec
+			changed = append(changed, port)
+		}
+		delete(want, port)
+	}
+	p.mu.Unlock()
+	for _, port := range removed {
+		p.Remove(port)
+	}
+	var errs []error
+	for port, spec := range want {
+		if addErr := p.Add(spec); addErr != nil {
+			errs = append(errs, fmt.Errorf("listen port %d: %w", port, addErr))
+			continue
+		}
+		added = append(added, port)
+	}
+	sort.Ints(added)
+	sort.Ints(removed)
+	sort.Ints(changed)
+	p.Logger.Info("apply listeners", "added", added, "removed", removed, "changed", changed)
+	return added, removed, changed, errors.Join(errs...)
+}
+
+// Listeners 当前的监听表，按端口排序
+func (p *TCPProtoConv) Listeners() []TCPListener {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	specs := make([]TCPListener, 0, len(p.listeners))
+	for _, tl := range p.listeners {
+		specs = append(specs, tl.spec)
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Port < specs[j].Port })
+	return specs
+}
+
+// Close 停止全部监听
+func (p *TCPProtoConv) Close() {
+	for _, spec := range p.Listeners() {
+		p.Remove(spec.Port)
+	}
+}
+
+// serve 接受连接并转发，监听关闭后返回
+func (p *TCPProtoConv) serve(tl *tcpListener) {
+	for {
+		conn, err := tl.listen.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			p.Logger.Debug("accept error, stop serving", "port", tl.listen.Addr().String(), logging.Err(err))
+			return
+		}
+		p.mu.Lock()
+		spec := tl.spec
+		p.mu.Unlock()
+		go p.proxy(conn, spec.DeviceID, spec.ServiceID)
+	}
+}
+
+func (p *TCPProtoConv) proxy(conn net.Conn, edgeDeviceID, edgeServiceID string) {
+	defer conn.Close()
+	l := p.Logger.With(logging.KeyDeviceID, edgeDeviceID, logging.KeyServiceID, edgeServiceID, logging.KeyRemoteAddr, conn.RemoteAddr().String())
+	l.Debug("accept success")
+	nextConn, err := dialRoute(p.Dialer, p.routes, p.RouteCacheTTL, metrics.ComponentTCPProtoConv, l, edgeDeviceID, edgeServiceID)
+	if err != nil {
+		// 路由不存在或 exposer server 不可达，拒绝连接
+		refuse(conn)
+		return
+	}
+	defer nextConn.Close()
+	relayStream(metrics.ComponentTCPProtoConv, l, conn, nextConn)
+}
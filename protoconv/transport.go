@@ -0,0 +1,141 @@
+package protoconv
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/helper"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+	"github.com/rectcircle/expose-edge-service-demo/metrics"
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
+)
+
+const (
+	// DefaultHTTPIdleConnTimeout 到边缘服务的空闲连接（一个 access stream）保留的时间，
+	// 一个 (设备, 服务) 的全部连接空闲超过该时间后，连同 Transport 一起释放。
+	// 空闲连接在 exposer server 上也算作正在处理的 access 请求，需要小于 exposer server 的 shutdown_timeout，
+	// 否则 exposer server 下线时总要等到超时
+	DefaultHTTPIdleConnTimeout = 20 * time.Second
+	// DefaultHTTPMaxIdleConns 每个 (设备, 服务) 保留的最大空闲连接数
+	DefaultHTTPMaxIdleConns = 16
+)
+
+// edgeTransport 一个 (设备, 服务) 的连接池和反向代理，请求之间复用 access stream
+type edgeTransport struct {
+	transport *http.Transport
+	proxy     *httputil.ReverseProxy
+	inflight  int64 // 正在处理的请求数
+	lastUsed  int64 // 最后一次请求结束的时间，unix nano
+}
+
+// acquireTransport 返回 (设备, 服务) 的 edgeTransport，不存在时创建。请求结束后需要调用 release
+func (p *HTTPProtoConv) acquireTransport(edgeDeviceID, edgeServiceID string) *edgeTransport {
+	key := helper.RouteKey(edgeServiceID, edgeDeviceID)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t, ok := p.transports[key]; ok {
+		atomic.AddInt64(&t.inflight, 1)
+		return t
+	}
+	p.evictOnce.Do(func() { go p.evictLoop() })
+	l := p.Logger.With(logging.KeyDeviceID, edgeDeviceID, logging.KeyServiceID, edgeServiceID)
+	t := &edgeTransport{
+		transport: &http.Transport{
+			// TCP over websocket，每个连接是一个 access stream
+			DialContext: func(_ context.Context, _ string, _ string) (net.Conn, error) {
+				return p.dialEdge(l, edgeDeviceID, edgeServiceID)
+			},
+			MaxIdleConns:        p.MaxIdleConns,
+			MaxIdleConnsPerHost: p.MaxIdleConns,
+			IdleConnTimeout:     p.IdleConnTimeout,
+		},
+	}
+	// 连接总是通过 DialContext 建立，host 部分不会被使用
+	t.proxy = httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: "edge"})
+	t.proxy.Transport = t.transport
+	t.proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		l.Warn("proxy error", logging.Err(err))
+		if errors.Is(err, routetable.ErrNotFound) {
+			helper.RespString(w, 502, "bad gateway: route table not found")
+			return
+		}
+		helper.RespString(w, 502, "bad gateway: "+err.Error())
+	}
+	t.inflight = 1
+	p.transports[key] = t
+	return t
+}
+
+func (t *edgeTransport) release() {
+	atomic.StoreInt64(&t.lastUsed, time.Now().UnixNano())
+	atomic.AddInt64(&t.inflight, -1)
+}
+
+// dialEdge 每次建立连接时查询路由表，设备重连到其他 exposer server 后新的连接使用新的路由。
+// 旧会话断开时，池中经过旧会话的连接随之关闭。
+func (p *HTTPProtoConv) dialEdge(l *slog.Logger, edgeDeviceID, edgeServiceID string) (net.Conn, error) {
+	route, err := p.routeTable.Lookup(edgeServiceID, edgeDeviceID)
+	if err == routetable.ErrNotFound {
+		metrics.AccessFailed(metrics.ComponentHTTPProtoConv, "route_not_found")
+		return nil, err
+	}
+	if err != nil {
+		l.Error("query route table error", logging.Err(err))
+		metrics.AccessFailed(metrics.ComponentHTTPProtoConv, "route_table")
+		return nil, err
+	}
+	IPPort := route.Addr
+	conn, err := p.Dialer.Dial(IPPort, edgeDeviceID, edgeServiceID)
+	if err != nil {
+		l.Warn("connect to exposer server error", "addr", IPPort, logging.Err(err))
+		metrics.AccessFailed(metrics.ComponentHTTPProtoConv, "dial")
+		return nil, err
+	}
+	l.Debug("connect to exposer server success", "addr", IPPort)
+	metrics.AccessOpened(metrics.ComponentHTTPProtoConv, edgeDeviceID, edgeServiceID)
+	return &helper.CountingConn{
+		Conn:    conn,
+		OnRead:  metrics.RelayCounter(metrics.ComponentHTTPProtoConv, metrics.DirectionFromEdge),
+		OnWrite: metrics.RelayCounter(metrics.ComponentHTTPProtoConv, metrics.DirectionToEdge),
+	}, nil
+}
+
+// evictLoop 定期释放空闲超过 IdleConnTimeout 的 edgeTransport，直到 Close
+func (p *HTTPProtoConv) evictLoop() {
+	ticker := time.NewTicker(helper.IdleCheckInterval(p.IdleConnTimeout))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.closeChan:
+			return
+		case <-ticker.C:
+		}
+		p.mu.Lock()
+		for key, t := range p.transports {
+			if atomic.LoadInt64(&t.inflight) > 0 || time.Since(time.Unix(0, atomic.LoadInt64(&t.lastUsed))) < p.IdleConnTimeout {
+				continue
+			}
+			t.transport.CloseIdleConnections()
+			delete(p.transports, key)
+		}
+		p.mu.Unlock()
+	}
+}
+
+// Close 关闭全部空闲连接，正在处理的请求不受影响
+func (p *HTTPProtoConv) Close() {
+	p.closeOnce.Do(func() { close(p.closeChan) })
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, t := range p.transports {
+		t.transport.CloseIdleConnections()
+		delete(p.transports, key)
+	}
+}
@@ -0,0 +1,220 @@
+package protoconv
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/helper"
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+	"github.com/rectcircle/expose-edge-service-demo/metrics"
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
+)
+
+const (
+	// DefaultUDPIdleTimeout udp flow 默认的空闲超时时间
+	DefaultUDPIdleTimeout = time.Minute
+	// DefaultUDPMaxFlows 默认的最大 flow 个数
+	DefaultUDPMaxFlows = 1024
+	// DefaultUDPFlowRate 默认每秒最多新建的 flow 个数
+	DefaultUDPFlowRate = 100
+	// udpFlowQueueSize 每个 flow 等待发往边缘服务的数据报个数，超出时丢弃（udp 语义）
+	udpFlowQueueSize = 64
+)
+
+// UDPProtoConv udp 协议转换服务，将监听端口收到的数据报转发到某个边缘设备的某个 udp 服务。
+// 每个来源地址是一个 flow，对应一个 access stream，数据报在 stream 上分帧传输（参见 helper.RelayDatagrams），
+// flow 空闲超过 IdleTimeout 后关闭。
+//
+// udp 来源地址可以伪造，协议转换服务不对调用方鉴权，能向监听端口发送数据报的任何人都可以访问边缘服务，
+// 只能部署在可信网络中。flow 个数超过 MaxFlows 或新建 flow 的速率超过 FlowRate 时丢弃新来源的数据报，
+// 避免伪造大量来源地址耗尽内存和 exposer server 的 access stream。
+type UDPProtoConv struct {
+	Dialer      *AccessDialer
+	IdleTimeout time.Duration
+	// MaxFlows 最大 flow 个数，0 表示不限制
+	MaxFlows int
+	// FlowRate 每秒最多新建的 flow 个数（允许突发 FlowRate 个），0 表示不限制
+	FlowRate int
+	Logger   *slog.Logger
+
+	routeTable    routetable.RouteTable
+	edgeDeviceID  string
+	edgeServiceID string
+
+	mu    sync.Mutex
+	flows map[string]*udpFlow // <来源地址> => flow
+	// 新建 flow 的令牌桶，受 mu 保护
+	flowTokens   float64
+	flowTokensAt time.Time
+}
+
+type udpFlow struct {
+	src  net.Addr
+	in   chan []byte // 来自调用方、等待发往边缘服务的数据报
+	done chan struct{}
+	once sync.Once
+	last int64 // 最后一次收发数据的时间，unix nano
+}
+
+func (f *udpFlow) touch() {
+	atomic.StoreInt64(&f.last, time.Now().UnixNano())
+}
+
+func (f *udpFlow) close() {
+	f.once.Do(func() { close(f.done) })
+}
+
+func NewUDPProtoConv(routeTable routetable.RouteTable, edgeDeviceID, edgeServiceID string) *UDPProtoConv {
+	return &UDPProtoConv{
+		Dialer:        &AccessDialer{},
+		IdleTimeout:   DefaultUDPIdleTimeout,
+		MaxFlows:      DefaultUDPMaxFlows,
+		FlowRate:      DefaultUDPFlowRate,
+		Logger:        slog.Default().With(logging.KeyComponent, metrics.ComponentUDPProtoConv),
+		routeTable:    routeTable,
+		edgeDeviceID:  edgeDeviceID,
+		edgeServiceID: edgeServiceID,
+		flows:         map[string]*udpFlow{},
+	}
+}
+
+// Serve 读取 pc 上的数据报并按来源地址转发，pc 关闭后关闭全部 flow 并返回
+func (p *UDPProtoConv) Serve(pc net.PacketConn) error {
+	buf := make([]byte, helper.MaxDatagramSize)
+	for {
+		n, src, err := pc.ReadFrom(buf)
+		if err != nil {
+			p.mu.Lock()
+			for _, f := range p.flows {
+				f.close()
+			}
+			p.mu.Unlock()
+			return err
+		}
+		pkt := append([]byte(nil), buf[:n]...)
+		key := src.String()
+		p.mu.Lock()
+		f, ok := p.flows[key]
+		if !ok {
+			if reason := p.admitFlow(); reason != "" {
+				p.mu.Unlock()
+				p.Logger.Debug("drop datagram", "reason", reason, logging.KeyRemoteAddr, key)
+				metrics.AccessFailed(metrics.ComponentUDPProtoConv, reason)
+				continue
+			}
+			f = &udpFlow{src: src, in: make(chan []byte, udpFlowQueueSize), done: make(chan struct{})}
+			p.flows[key] = f
+			go p.runFlow(pc, f)
+		}
+		p.mu.Unlock()
+		f.touch()
+		select {
+		case f.in <- pkt:
+		case <-f.done:
+		default:
+			// 边缘服务处理不过来，丢弃
+		}
+	}
+}
+
+// admitFlow 检查是否可以新建 flow，不可以时返回原因。调用方持有 mu
+func (p *UDPProtoConv) admitFlow() string {
+	if p.MaxFlows > 0 && len(p.flows) >= p.MaxFlows {
+		return "flow_limit"
+	}
+	if p.FlowRate > 0 {
+		now := time.Now()
+		burst := float64(p.FlowRate)
+		if p.flowTokensAt.IsZero() {
+			p.flowTokens = burst
+		} else {
+			p.flowTokens += now.Sub(p.flowTokensAt).Seconds() * burst
+			if p.flowTokens > burst {
+				p.flowTokens = burst
+			}
+		}
+		p.flowTokensAt = now
+		if p.flowTokens < 1 {
+			return "rate_limited"
+		}
+		p.flowTokens--
+	}
+	return ""
+}
+
+// runFlow 为一个来源地址打开 access stream 并双向转发，直到出错或空闲超时
+func (p *UDPProtoConv) runFlow(pc net.PacketConn, f *udpFlow) {
+	l := p.Logger.With(logging.KeyDeviceID, p.edgeDeviceID, logging.KeyServiceID, p.edgeServiceID, logging.KeyRemoteAddr, f.src.String())
+	defer func() {
+		f.close()
+		p.mu.Lock()
+		if p.flows[f.src.String()] == f {
+			delete(p.flows, f.src.String())
+		}
+		p.mu.Unlock()
+	}()
+	// 每个 flow 查询一次路由，设备重连到其他 exposer server 后新的 flow 可以使用新的路由
+	route, err := p.routeTable.Lookup(p.edgeServiceID, p.edgeDeviceID)
+	if err != nil {
+		l.Warn("query route table error", logging.Err(err))
+		reason := "route_table"
+		if errors.Is(err, routetable.ErrNotFound) {
+			reason = "route_not_found"
+		}
+		metrics.AccessFailed(metrics.ComponentUDPProtoConv, reason)
+		return
+	}
+	stream, err := p.Dialer.Dial(route.Addr, p.edgeDeviceID, p.edgeServiceID)
+	if err != nil {
+		l.Warn("connect to exposer server error", "addr", route.Addr, logging.Err(err))
+		metrics.AccessFailed(metrics.ComponentUDPProtoConv, "dial")
+		return
+	}
+	defer stream.Close()
+	l.Debug("udp flow opened", "addr", route.Addr)
+	metrics.AccessOpened(metrics.ComponentUDPProtoConv, p.edgeDeviceID, p.edgeServiceID)
+	toEdge := metrics.RelayCounter(metrics.ComponentUDPProtoConv, metrics.DirectionToEdge)
+	fromEdge := metrics.RelayCounter(metrics.ComponentUDPProtoConv, metrics.DirectionFromEdge)
+	// 边缘服务 -> 调用方
+	go func() {
+		defer f.close()
+		buf := make([]byte, helper.MaxDatagramSize)
+		for {
+			n, err := helper.ReadDatagram(stream, buf)
+			if err != nil {
+				return
+			}
+			if _, err := pc.WriteTo(buf[:n], f.src); err != nil {
+				l.Debug("write to caller error", logging.Err(err))
+				return
+			}
+			f.touch()
+			fromEdge(n)
+		}
+	}()
+	// 调用方 -> 边缘服务
+	ticker := time.NewTicker(helper.IdleCheckInterval(p.IdleTimeout))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.done:
+			l.Debug("udp flow closed")
+			return
+		case pkt := <-f.in:
+			if err := helper.WriteDatagram(stream, pkt); err != nil {
+				l.Debug("write datagram error", logging.Err(err))
+				return
+			}
+			toEdge(len(pkt))
+		case <-ticker.C:
+			if time.Since(time.Unix(0, atomic.LoadInt64(&f.last))) > p.IdleTimeout {
+				l.Debug("udp flow idle timeout", "idle_timeout", p.IdleTimeout)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package protoconv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
+)
+
+func TestUDPAdmitFlow(t *testing.T) {
+	p := NewUDPProtoConv(routetable.NewMemoryRouteTable(), "DEVICE-0000", "demo3")
+	p.MaxFlows, p.FlowRate = 2, 0
+	for i, want := range []string{"", "", "flow_limit"} {
+		if got := p.admitFlow(); got != want {
+			t.Fatalf("MaxFlows: flow %d admit = %q, want %q", i, got, want)
+		}
+		if want == "" {
+			p.flows[string(rune('a'+i))] = &udpFlow{}
+		}
+	}
+
+	p = NewUDPProtoConv(routetable.NewMemoryRouteTable(), "DEVICE-0000", "demo3")
+	p.MaxFlows, p.FlowRate = 0, 3
+	// 允许突发 FlowRate 个
+	for i, want := range []string{"", "", "", "rate_limited"} {
+		if got := p.admitFlow(); got != want {
+			t.Fatalf("FlowRate: flow %d admit = %q, want %q", i, got, want)
+		}
+	}
+	// 一秒后补充 FlowRate 个令牌
+	p.flowTokensAt = p.flowTokensAt.Add(-time.Second)
+	for i, want := range []string{"", "", "", "rate_limited"} {
+		if got := p.admitFlow(); got != want {
+			t.Fatalf("FlowRate after refill: flow %d admit = %q, want %q", i, got, want)
+		}
+	}
+}
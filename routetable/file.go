@@ -0,0 +1,227 @@
+package routetable
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type fileEntry struct {
+	ServiceID  string    `json:"service_id"`
+	DeviceID   string    `json:"device_id"`
+	Addr       string    `json:"addr"`
+	SessionID  string    `json:"session_id,omitempty"`
+	Generation int64     `json:"generation,omitempty"`
+	ExpireAt   time.Time `json:"expire_at"`
+}
+
+// FileRouteTable 基于本地 json 文件的路由表，适用于单机部署多个进程共享路由表（无 redis）。
+// 会话代数计数器保存在 <path>.generation 中。
+// 多进程之间通过 flock 互斥，仅示例，请勿用于生产。
+type FileRouteTable struct {
+	path string
+	mu   sync.Mutex
+}
+
+var _ RouteTable = &FileRouteTable{}
+
+func NewFileRouteTable(path string) *FileRouteTable {
+	return &FileRouteTable{path: path}
+}
+
+func (t *FileRouteTable) Register(route Route, ttl time.Duration) error {
+	if err := route.Validate(); err != nil {
+		return err
+	}
+	return t.update(func(entries map[string]fileEntry) error {
+		key := memoryKey(route.ServiceID, route.DeviceID)
+		if e, ok := entries[key]; ok && e.route().Supersedes(route) {
+			return ErrNotOwner
+		}
+		entries[key] = fileEntry{
+			ServiceID:  route.ServiceID,
+			DeviceID:   route.DeviceID,
+			Addr:       route.Addr,
+			SessionID:  route.SessionID,
+			Generation: route.Generation,
+			ExpireAt:   time.Now().Add(ttl),
+		}
+		return nil
+	})
+}
+
+func (t *FileRouteTable) Refresh(route Route, ttl time.Duration) error {
+	return t.Register(route, ttl)
+}
+
+func (t *FileRouteTable) Lookup(serviceID, deviceID string) (Route, error) {
+	var route Route
+	var found bool
+	err := t.view(func(entries map[string]fileEntry) {
+		e, ok := entries[memoryKey(serviceID, deviceID)]
+		if ok {
+			route, found = e.route(), true
+		}
+	})
+	if err != nil {
+		return Route{}, err
+	}
+	if !found {
+		return Route{}, ErrNotFound
+	}
+	return route, nil
+}
+
+func (t *FileRouteTable) NextGeneration() (int64, error) {
+	var generation int64
+	err := t.withLock(syscall.LOCK_EX, func() error {
+		path := t.path + ".generation"
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if s := strings.TrimSpace(string(data)); s != "" {
+			if generation, err = strconv.ParseInt(s, 10, 64); err != nil {
+				return err
+			}
+		}
+		generation++
+		return writeFileAtomic(path, []byte(strconv.FormatInt(generation, 10)+"\n"))
+	})
+	return generation, err
+}
+
+func (t *FileRouteTable) Unregister(route Route) error {
+	return t.update(func(entries map[string]fileEntry) error {
+		key := memoryKey(route.ServiceID, route.DeviceID)
+		e, ok := entries[key]
+		if !ok {
+			return nil
+		}
+		if !e.route().SameOwner(route) {
+			return ErrNotOwner
+		}
+		delete(entries, key)
+		return nil
+	})
+}
+
+func (t *FileRouteTable) List() ([]Route, error) {
+	var routes []Route
+	err := t.view(func(entries map[string]fileEntry) {
+		for _, e := range entries {
+			routes = append(routes, e.route())
+		}
+	})
+	return routes, err
+}
+
+func (t *FileRouteTable) Watch(ctx context.Context) (<-chan Event, error) {
+	return pollWatch(ctx, defaultPollInterval, t.List), nil
+}
+
+func (t *FileRouteTable) Close() error {
+	return nil
+}
+
+func (e fileEntry) route() Route {
+	return Route{ServiceID: e.ServiceID, DeviceID: e.DeviceID, Addr: e.Addr, SessionID: e.SessionID, Generation: e.Generation}
+}
+
+// view 在共享锁下读取未过期的路由
+func (t *FileRouteTable) view(fn func(entries map[string]fileEntry)) error {
+	return t.withLock(syscall.LOCK_SH, func() error {
+		entries, err := t.load()
+		if err != nil {
+			return err
+		}
+		fn(entries)
+		return nil
+	})
+}
+
+// update 在排他锁下读取、修改并写回路由表，fn 返回错误时不写回
+func (t *FileRouteTable) update(fn func(entries map[string]fileEntry) error) error {
+	return t.withLock(syscall.LOCK_EX, func() error {
+		entries, err := t.load()
+		if err != nil {
+			return err
+		}
+		if err := fn(entries); err != nil {
+			return err
+		}
+		return t.store(entries)
+	})
+}
+
+func (t *FileRouteTable) withLock(how int, fn func() error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lock, err := os.OpenFile(t.path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), how); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+	return fn()
+}
+
+func (t *FileRouteTable) load() (map[string]fileEntry, error) {
+	entries := map[string]fileEntry{}
+	data, err := os.ReadFile(t.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	for key, e := range entries {
+		if e.ExpireAt.Before(now) {
+			delete(entries, key)
+		}
+	}
+	return entries, nil
+}
+
+func (t *FileRouteTable) store(entries map[string]fileEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(t.path, data)
+}
+
+// writeFileAtomic 先写临时文件再 rename，保证读者不会看到写了一半的文件
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
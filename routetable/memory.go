@@ -0,0 +1,150 @@
+package routetable
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	route    Route
+	expireAt time.Time
+}
+
+// MemoryRouteTable 进程内的路由表，用于单机运行和测试，不需要 redis
+type MemoryRouteTable struct {
+	mu         sync.Mutex
+	entries    map[string]memoryEntry // <service-id>:<device-id> => entry
+	generation int64                  // 最近一次分配的会话代数
+	watchers   map[chan Event]context.Context
+}
+
+var _ RouteTable = &MemoryRouteTable{}
+
+func NewMemoryRouteTable() *MemoryRouteTable {
+	return &MemoryRouteTable{
+		entries:  map[string]memoryEntry{},
+		watchers: map[chan Event]context.Context{},
+	}
+}
+
+func memoryKey(serviceID, deviceID string) string {
+	return serviceID + ":" + deviceID
+}
+
+func (t *MemoryRouteTable) Register(route Route, ttl time.Duration) error {
+	return t.put(route, ttl)
+}
+
+func (t *MemoryRouteTable) Refresh(route Route, ttl time.Duration) error {
+	return t.put(route, ttl)
+}
+
+// put 写入路由，已有的路由属于更新的会话时返回 ErrNotOwner。路由变化时通知 watcher
+func (t *MemoryRouteTable) put(route Route, ttl time.Duration) error {
+	if err := route.Validate(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expireLocked()
+	key := memoryKey(route.ServiceID, route.DeviceID)
+	old, ok := t.entries[key]
+	if ok && old.route.Supersedes(route) {
+		return ErrNotOwner
+	}
+	t.entries[key] = memoryEntry{route: route, expireAt: time.Now().Add(ttl)}
+	if !ok || old.route != route {
+		t.notifyLocked(Event{Type: EventTypePut, Route: route})
+	}
+	return nil
+}
+
+func (t *MemoryRouteTable) Lookup(serviceID, deviceID string) (Route, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expireLocked()
+	e, ok := t.entries[memoryKey(serviceID, deviceID)]
+	if !ok {
+		return Route{}, ErrNotFound
+	}
+	return e.route, nil
+}
+
+func (t *MemoryRouteTable) NextGeneration() (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.generation++
+	return t.generation, nil
+}
+
+func (t *MemoryRouteTable) Unregister(route Route) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expireLocked()
+	key := memoryKey(route.ServiceID, route.DeviceID)
+	e, ok := t.entries[key]
+	if !ok {
+		return nil
+	}
+	if !e.route.SameOwner(route) {
+		return ErrNotOwner
+	}
+	delete(t.entries, key)
+	t.notifyLocked(Event{Type: EventTypeDelete, Route: e.route})
+	return nil
+}
+
+func (t *MemoryRouteTable) List() ([]Route, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expireLocked()
+	routes := make([]Route, 0, len(t.entries))
+	for _, e := range t.entries {
+		routes = append(routes, e.route)
+	}
+	return routes, nil
+}
+
+func (t *MemoryRouteTable) Watch(ctx context.Context) (<-chan Event, error) {
+	ch := make(chan Event, 64)
+	t.mu.Lock()
+	t.watchers[ch] = ctx
+	t.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		t.mu.Lock()
+		delete(t.watchers, ch)
+		t.mu.Unlock()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+func (t *MemoryRouteTable) Close() error {
+	return nil
+}
+
+// expireLocked 惰性清理过期路由
+func (t *MemoryRouteTable) expireLocked() {
+	now := time.Now()
+	for key, e := range t.entries {
+		if e.expireAt.Before(now) {
+			delete(t.entries, key)
+			t.notifyLocked(Event{Type: EventTypeDelete, Route: e.route})
+		}
+	}
+}
+
+func (t *MemoryRouteTable) notifyLocked(e Event) {
+	for ch, ctx := range t.watchers {
+		if ctx.Err() != nil {
+			continue
+		}
+		select {
+		case ch <- e:
+		default:
+			// 消费太慢，丢弃事件，避免阻塞路由表
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package routetable
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Open 根据 dsn 创建路由表：
+//   - redis://host:port            RedisRouteTable，集群部署
+//   - file:/path/to/routes.json    FileRouteTable，单机部署多个进程共享路由表，也可以写作 file:///path 或 file:相对路径
+//   - memory://                    MemoryRouteTable，只在进程内可见，用于单独运行 exposer server 调试
+func Open(dsn string) (RouteTable, error) {
+	backend, target, err := parseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	switch backend {
+	case "redis":
+		return NewRedisRouteTable(target), nil
+	case "file":
+		return NewFileRouteTable(target), nil
+	default:
+		return NewMemoryRouteTable(), nil
+	}
+}
+
+// ValidateDSN 校验 dsn 的格式，不会连接后端
+func ValidateDSN(dsn string) error {
+	_, _, err := parseDSN(dsn)
+	return err
+}
+
+func parseDSN(dsn string) (backend, target string, err error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid route table dsn %q: %w", dsn, err)
+	}
+	switch u.Scheme {
+	case "redis":
+		if _, _, err := net.SplitHostPort(u.Host); err != nil {
+			return "", "", fmt.Errorf("invalid route table dsn %q: want redis://host:port", dsn)
+		}
+		return "redis", u.Host, nil
+	case "file":
+		path := u.Opaque
+		if path == "" && u.Host == "" {
+			path = u.Path
+		}
+		if path == "" {
+			return "", "", fmt.Errorf("invalid route table dsn %q: want file:/path/to/routes.json", dsn)
+		}
+		return "file", path, nil
+	case "memory":
+		if strings.Trim(u.Opaque+u.Host+u.Path, "/") != "" {
+			return "", "", fmt.Errorf("invalid route table dsn %q: want memory://", dsn)
+		}
+		return "memory", "", nil
+	}
+	return "", "", fmt.Errorf("invalid route table dsn %q: unknown backend %q, want redis, file or memory", dsn, u.Scheme)
+}
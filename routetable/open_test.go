@@ -0,0 +1,34 @@
+package routetable_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
+)
+
+func TestOpen(t *testing.T) {
+	for dsn, want := range map[string]string{
+		"redis://localhost:6379":  "*routetable.RedisRouteTable",
+		"file:/tmp/routes.json":   "*routetable.FileRouteTable",
+		"file:///tmp/routes.json": "*routetable.FileRouteTable",
+		"file:routes.json":        "*routetable.FileRouteTable",
+		"memory://":               "*routetable.MemoryRouteTable",
+		"memory:":                 "*routetable.MemoryRouteTable",
+	} {
+		rt, err := routetable.Open(dsn)
+		if err != nil {
+			t.Errorf("Open(%q): %v", dsn, err)
+			continue
+		}
+		if got := fmt.Sprintf("%T", rt); got != want {
+			t.Errorf("Open(%q) = %s, want %s", dsn, got, want)
+		}
+		_ = rt.Close()
+	}
+	for _, dsn := range []string{"", "localhost:6379", "redis://localhost", "file://", "memory://x", "etcd://localhost:2379"} {
+		if _, err := routetable.Open(dsn); err == nil {
+			t.Errorf("Open(%q) want error", dsn)
+		}
+	}
+}
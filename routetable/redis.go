@@ -0,0 +1,203 @@
+package routetable
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/rectcircle/expose-edge-service-demo/helper"
+)
+
+// RedisRouteTable 基于 redis 的路由表。
+// 数据结构: exposer-route-table:<service-id>:<device-id> => `<exposer server ip:port> <session-id> <generation>`，
+// 只有地址的旧格式视为代数 0，会被任意会话覆盖。
+// 会话代数: exposer-route-generation => 计数器，NextGeneration 通过 INCR 分配
+type RedisRouteTable struct {
+	rdb *redis.Client
+}
+
+var _ RouteTable = &RedisRouteTable{}
+
+func NewRedisRouteTable(addr string) *RedisRouteTable {
+	return &RedisRouteTable{rdb: redis.NewClient(&redis.Options{Addr: addr})}
+}
+
+// 路由表的修改都通过 lua 脚本完成，检查所有权和写入在 redis 中原子执行：
+// 设备迁移到其他节点后，旧节点的刷新和删除不会覆盖或删除新节点的路由。
+// 代数由 NextGeneration 通过 INCR 分配，是不带前导 0 的非负十进制整数；lua number 是 double，
+// 不转换为数字，按十进制字符串比较（先比较长度，长度相同时按字典序），代数相同时比较会话 ID。
+const redisRouteScriptLib = `
+local function parse(value)
+	local f = {}
+	for w in string.gmatch(value, '%S+') do f[#f + 1] = w end
+	if #f >= 3 then return f[2], f[3] end
+	if #f == 2 then return '', f[2] end
+	return '', '0'
+end
+local function newer(g1, s1, g2, s2)
+	if #g1 ~= #g2 then return #g1 > #g2 end
+	if g1 ~= g2 then return g1 > g2 end
+	return s1 > s2
+end
+`
+
+var (
+	// redisPutScript KEYS[1] 路由 key，ARGV: 值、会话 ID、代数、ttl 毫秒。已有的路由属于更新的会话时返回 0
+	redisPutScript = redis.NewScript(redisRouteScriptLib + `
+local cur = redis.call('GET', KEYS[1])
+if cur then
+	local sid, gen = parse(cur)
+	if newer(gen, sid, ARGV[3], ARGV[2]) then return 0 end
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[4])
+return 1
+`)
+	// redisUnregisterScript KEYS[1] 路由 key，ARGV: 会话 ID、代数。路由属于其他会话时返回 0
+	redisUnregisterScript = redis.NewScript(redisRouteScriptLib + `
+local cur = redis.call('GET', KEYS[1])
+if not cur then return 1 end
+local sid, gen = parse(cur)
+if sid ~= ARGV[1] or gen ~= ARGV[2] then return 0 end
+redis.call('DEL', KEYS[1])
+return 1
+`)
+)
+
+func (t *RedisRouteTable) Register(route Route, ttl time.Duration) error {
+	return t.put(route, ttl)
+}
+
+func (t *RedisRouteTable) Refresh(route Route, ttl time.Duration) error {
+	return t.put(route, ttl)
+}
+
+// put 写入路由，已有的路由属于更新的会话时返回 ErrNotOwner
+func (t *RedisRouteTable) put(route Route, ttl time.Duration) error {
+	if err := route.Validate(); err != nil {
+		return err
+	}
+	key := helper.RouteKey(route.ServiceID, route.DeviceID)
+	ok, err := redisPutScript.Run(t.rdb, []string{key},
+		encodeRedisRoute(route), route.SessionID, strconv.FormatInt(route.Generation, 10), ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrNotOwner
+	}
+	return nil
+}
+
+func (t *RedisRouteTable) Lookup(serviceID, deviceID string) (Route, error) {
+	route, ok, err := getRoute(t.rdb, helper.RouteKey(serviceID, deviceID), serviceID, deviceID)
+	if err != nil {
+		return Route{}, err
+	}
+	if !ok {
+		return Route{}, ErrNotFound
+	}
+	return route, nil
+}
+
+func (t *RedisRouteTable) NextGeneration() (int64, error) {
+	return t.rdb.Incr(helper.RouteGenerationKey).Result()
+}
+
+func (t *RedisRouteTable) Unregister(route Route) error {
+	key := helper.RouteKey(route.ServiceID, route.DeviceID)
+	ok, err := redisUnregisterScript.Run(t.rdb, []string{key},
+		route.SessionID, strconv.FormatInt(route.Generation, 10)).Int64()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrNotOwner
+	}
+	return nil
+}
+
+// getRoute 读取并解析路由，ok 为 false 表示不存在
+func getRoute(c redis.Cmdable, key, serviceID, deviceID string) (route Route, ok bool, err error) {
+	value, err := c.Get(key).Result()
+	if err == redis.Nil {
+		return Route{}, false, nil
+	}
+	if err != nil {
+		return Route{}, false, err
+	}
+	return decodeRedisRoute(serviceID, deviceID, value)
+}
+
+func encodeRedisRoute(route Route) string {
+	return route.Addr + " " + route.SessionID + " " + strconv.FormatInt(route.Generation, 10)
+}
+
+func decodeRedisRoute(serviceID, deviceID, value string) (route Route, ok bool, err error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return Route{}, false, nil
+	}
+	route = Route{ServiceID: serviceID, DeviceID: deviceID, Addr: fields[0]}
+	generation := "0"
+	switch {
+	case len(fields) >= 3:
+		route.SessionID, generation = fields[1], fields[2]
+	case len(fields) == 2:
+		// 会话 ID 为空
+		generation = fields[1]
+	}
+	if route.Generation, err = strconv.ParseInt(generation, 10, 64); err != nil {
+		return Route{}, false, err
+	}
+	return route, true, nil
+}
+
+func (t *RedisRouteTable) List() ([]Route, error) {
+	var keys []string
+	var cursor uint64
+	for {
+		batch, next, err := t.rdb.Scan(cursor, helper.RouteKeyPrefix+"*", 100).Result()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, batch...)
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	values, err := t.rdb.MGet(keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	routes := make([]Route, 0, len(keys))
+	for i, key := range keys {
+		value, ok := values[i].(string)
+		if !ok {
+			continue // 在 SCAN 和 MGET 之间过期了
+		}
+		serviceID, deviceID, ok := helper.ParseRouteKey(key)
+		if !ok {
+			continue
+		}
+		route, ok, err := decodeRedisRoute(serviceID, deviceID, value)
+		if err != nil || !ok {
+			continue
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+func (t *RedisRouteTable) Watch(ctx context.Context) (<-chan Event, error) {
+	return pollWatch(ctx, defaultPollInterval, t.List), nil
+}
+
+func (t *RedisRouteTable) Close() error {
+	return t.rdb.Close()
+}
@@ -0,0 +1,101 @@
+package routetable
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound 路由表中不存在该 (service, device) 的路由
+	ErrNotFound = errors.New("route not found")
+	// ErrNotOwner 路由已经属于更新的会话（例如设备重连到了其他 exposer server），旧会话不能再修改或删除
+	ErrNotOwner = errors.New("route owned by a newer session")
+	// ErrInvalidID 设备 ID 或服务 ID 为空或包含 `:`，无法编码到路由表的 key 中
+	ErrInvalidID = errors.New("invalid device or service id")
+)
+
+// ValidateID 校验设备 ID 或服务 ID 可以作为路由表 key 的一部分（参见 helper.RouteKey）
+func ValidateID(id string) error {
+	if id == "" {
+		return fmt.Errorf("%w: must not be empty", ErrInvalidID)
+	}
+	if strings.Contains(id, ":") {
+		return fmt.Errorf("%w: %q must not contain ':'", ErrInvalidID, id)
+	}
+	return nil
+}
+
+// Route 全局路由表中的一条记录：某个设备的某个服务连接在哪个 exposer server 上
+type Route struct {
+	ServiceID string
+	DeviceID  string
+	Addr      string // exposer server ip:port
+	// SessionID、Generation 注册该路由的设备会话及其代数（会话建立时由 RouteTable.NextGeneration 分配），用于 fencing：
+	// 同一个 (service, device) 有多个会话时，代数较大的会话获胜，代数相同时会话 ID 较大的获胜
+	SessionID  string
+	Generation int64
+}
+
+// Supersedes r 所属的会话是否比 o 更新
+func (r Route) Supersedes(o Route) bool {
+	if r.Generation != o.Generation {
+		return r.Generation > o.Generation
+	}
+	return r.SessionID > o.SessionID
+}
+
+// Validate 校验路由的设备 ID 和服务 ID，注册和刷新前调用
+func (r Route) Validate() error {
+	if err := ValidateID(r.ServiceID); err != nil {
+		return fmt.Errorf("service id: %w", err)
+	}
+	if err := ValidateID(r.DeviceID); err != nil {
+		return fmt.Errorf("device id: %w", err)
+	}
+	return nil
+}
+
+// SameOwner r 和 o 是否属于同一个会话
+func (r Route) SameOwner(o Route) bool {
+	return r.SessionID == o.SessionID && r.Generation == o.Generation
+}
+
+type EventType string
+
+const (
+	EventTypePut    EventType = "put"
+	EventTypeDelete EventType = "delete"
+)
+
+// Event 路由表变更事件
+type Event struct {
+	Type  EventType
+	Route Route
+}
+
+// RouteTable 全局路由表，记录 (service, device) => exposer server ip:port。
+// exposer server 负责注册和刷新，协议转换服务负责查询。
+// Register、Refresh、Unregister 检查所有权和修改必须是原子的（memory 使用互斥锁、file 使用文件锁、redis 使用 lua 脚本），
+// 否则设备在 exposer server 之间迁移时，旧节点的检查和修改之间可能插入新节点的注册。
+type RouteTable interface {
+	// Register 注册一条路由，ttl 到期后自动失效。已有的路由属于更新的会话时返回 ErrNotOwner，否则覆盖。
+	// 设备 ID 或服务 ID 不合法时返回 ErrInvalidID
+	Register(route Route, ttl time.Duration) error
+	// Refresh 刷新一条路由的 ttl，路由不存在时重新写入。已有的路由属于更新的会话时返回 ErrNotOwner
+	Refresh(route Route, ttl time.Duration) error
+	// Lookup 查询路由，不存在时返回 ErrNotFound
+	Lookup(serviceID, deviceID string) (Route, error)
+	// NextGeneration 为新建立的设备会话分配代数，在整个路由表内单调递增，不依赖各个 exposer server 的时钟
+	NextGeneration() (int64, error)
+	// Unregister 删除 route 所属会话的路由，路由已经属于其他会话时返回 ErrNotOwner，不存在时返回 nil
+	Unregister(route Route) error
+	// List 列出全部路由
+	List() ([]Route, error)
+	// Watch 监听路由表变更，ctx 结束后关闭返回的 channel
+	Watch(ctx context.Context) (<-chan Event, error)
+	// Close 释放底层资源
+	Close() error
+}
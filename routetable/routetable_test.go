@@ -0,0 +1,231 @@
+package routetable_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/routetable"
+)
+
+// 同一套用例分别在 memory、file、redis 三种后端上运行。
+// redis 需要通过环境变量 EDGE_TEST_REDIS_ADDR 指定，未指定时跳过。
+
+const testRedisAddrEnvKey = "EDGE_TEST_REDIS_ADDR"
+
+func TestMemoryRouteTable(t *testing.T) {
+	testRouteTable(t, func(t *testing.T) routetable.RouteTable {
+		return routetable.NewMemoryRouteTable()
+	})
+}
+
+func TestFileRouteTable(t *testing.T) {
+	testRouteTable(t, func(t *testing.T) routetable.RouteTable {
+		return routetable.NewFileRouteTable(filepath.Join(t.TempDir(), "routes.json"))
+	})
+}
+
+func TestRedisRouteTable(t *testing.T) {
+	addr := os.Getenv(testRedisAddrEnvKey)
+	if addr == "" {
+		t.Skipf("%s not set", testRedisAddrEnvKey)
+	}
+	testRouteTable(t, func(t *testing.T) routetable.RouteTable {
+		return routetable.NewRedisRouteTable(addr)
+	})
+}
+
+func testRouteTable(t *testing.T, open func(t *testing.T) routetable.RouteTable) {
+	// 设备 ID 每次运行都不同，共享的 redis 中不会残留上一次的路由
+	deviceID := fmt.Sprintf("DEVICE-%d", time.Now().UnixNano())
+	route := func(serviceID, addr string) routetable.Route {
+		return routetable.Route{ServiceID: serviceID, DeviceID: deviceID, Addr: addr, SessionID: "s1", Generation: 1}
+	}
+	newTable := func(t *testing.T) routetable.RouteTable {
+		rt := open(t)
+		t.Cleanup(func() { _ = rt.Close() })
+		return rt
+	}
+
+	t.Run("RegisterLookup", func(t *testing.T) {
+		rt := newTable(t)
+		want := route("demo1", "10.0.0.1:8080")
+		mustNoError(t, rt.Register(want, time.Minute))
+		defer rt.Unregister(want)
+		got, err := rt.Lookup("demo1", deviceID)
+		mustNoError(t, err)
+		if got != want {
+			t.Fatalf("Lookup = %+v, want %+v", got, want)
+		}
+		if _, err := rt.Lookup("demo2", deviceID); !errors.Is(err, routetable.ErrNotFound) {
+			t.Fatalf("Lookup missing route error = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("RefreshRewritesExpiredRoute", func(t *testing.T) {
+		rt := newTable(t)
+		r := route("demo1", "10.0.0.1:8080")
+		mustNoError(t, rt.Refresh(r, time.Minute))
+		defer rt.Unregister(r)
+		if _, err := rt.Lookup("demo1", deviceID); err != nil {
+			t.Fatalf("Lookup after Refresh of missing route: %v", err)
+		}
+	})
+
+	t.Run("Unregister", func(t *testing.T) {
+		rt := newTable(t)
+		r := route("demo1", "10.0.0.1:8080")
+		mustNoError(t, rt.Register(r, time.Minute))
+		mustNoError(t, rt.Unregister(r))
+		if _, err := rt.Lookup("demo1", deviceID); !errors.Is(err, routetable.ErrNotFound) {
+			t.Fatalf("Lookup after Unregister error = %v, want ErrNotFound", err)
+		}
+		// 不存在的路由
+		mustNoError(t, rt.Unregister(r))
+	})
+
+	t.Run("Expire", func(t *testing.T) {
+		rt := newTable(t)
+		r := route("demo1", "10.0.0.1:8080")
+		mustNoError(t, rt.Register(r, 50*time.Millisecond))
+		time.Sleep(200 * time.Millisecond)
+		if _, err := rt.Lookup("demo1", deviceID); !errors.Is(err, routetable.ErrNotFound) {
+			t.Fatalf("Lookup after ttl error = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		rt := newTable(t)
+		want := map[string]routetable.Route{
+			"demo1": route("demo1", "10.0.0.1:8080"),
+			"demo2": route("demo2", "10.0.0.2:8080"),
+		}
+		for _, r := range want {
+			mustNoError(t, rt.Register(r, time.Minute))
+			defer rt.Unregister(r)
+		}
+		routes, err := rt.List()
+		mustNoError(t, err)
+		got := map[string]routetable.Route{}
+		for _, r := range routes {
+			if r.DeviceID == deviceID {
+				got[r.ServiceID] = r
+			}
+		}
+		if len(got) != len(want) || got["demo1"] != want["demo1"] || got["demo2"] != want["demo2"] {
+			t.Fatalf("List = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("Ownership", func(t *testing.T) {
+		rt := newTable(t)
+		// 设备迁移到其他节点：新会话代数更大
+		stale := route("demo1", "10.0.0.1:8080")
+		newer := routetable.Route{ServiceID: "demo1", DeviceID: deviceID, Addr: "10.0.0.2:8080", SessionID: "s2", Generation: 2}
+		mustNoError(t, rt.Register(stale, time.Minute))
+		mustNoError(t, rt.Register(newer, time.Minute))
+		defer rt.Unregister(newer)
+		if err := rt.Refresh(stale, time.Minute); !errors.Is(err, routetable.ErrNotOwner) {
+			t.Fatalf("Refresh by stale owner error = %v, want ErrNotOwner", err)
+		}
+		if err := rt.Unregister(stale); !errors.Is(err, routetable.ErrNotOwner) {
+			t.Fatalf("Unregister by stale owner error = %v, want ErrNotOwner", err)
+		}
+		if err := rt.Register(stale, time.Minute); !errors.Is(err, routetable.ErrNotOwner) {
+			t.Fatalf("Register with older generation error = %v, want ErrNotOwner", err)
+		}
+		// 代数相同时会话 ID 较大的获胜
+		if err := rt.Register(routetable.Route{ServiceID: "demo1", DeviceID: deviceID, Addr: "10.0.0.3:8080", SessionID: "s1", Generation: 2}, time.Minute); !errors.Is(err, routetable.ErrNotOwner) {
+			t.Fatalf("Register with same generation and smaller session id error = %v, want ErrNotOwner", err)
+		}
+		got, err := rt.Lookup("demo1", deviceID)
+		mustNoError(t, err)
+		if got != newer {
+			t.Fatalf("Lookup = %+v, want newer route %+v", got, newer)
+		}
+		// 同一会话可以刷新和删除
+		mustNoError(t, rt.Refresh(newer, time.Minute))
+		mustNoError(t, rt.Unregister(newer))
+	})
+
+	t.Run("OwnershipGenerationDigits", func(t *testing.T) {
+		rt := newTable(t)
+		// redis 按十进制字符串比较代数，位数不同时不能按字典序比较
+		stale := routetable.Route{ServiceID: "demo1", DeviceID: deviceID, Addr: "10.0.0.1:8080", SessionID: "s9", Generation: 9}
+		newer := routetable.Route{ServiceID: "demo1", DeviceID: deviceID, Addr: "10.0.0.2:8080", SessionID: "s1", Generation: 10}
+		mustNoError(t, rt.Register(stale, time.Minute))
+		mustNoError(t, rt.Register(newer, time.Minute))
+		defer rt.Unregister(newer)
+		if err := rt.Register(stale, time.Minute); !errors.Is(err, routetable.ErrNotOwner) {
+			t.Fatalf("Register with generation 9 after 10 error = %v, want ErrNotOwner", err)
+		}
+		if err := rt.Unregister(stale); !errors.Is(err, routetable.ErrNotOwner) {
+			t.Fatalf("Unregister by stale owner error = %v, want ErrNotOwner", err)
+		}
+		got, err := rt.Lookup("demo1", deviceID)
+		mustNoError(t, err)
+		if got != newer {
+			t.Fatalf("Lookup = %+v, want newer route %+v", got, newer)
+		}
+	})
+
+	t.Run("NextGeneration", func(t *testing.T) {
+		rt := newTable(t)
+		last, err := rt.NextGeneration()
+		mustNoError(t, err)
+		for i := 0; i < 3; i++ {
+			generation, err := rt.NextGeneration()
+			mustNoError(t, err)
+			if generation <= last {
+				t.Fatalf("NextGeneration = %d after %d, want increasing", generation, last)
+			}
+			last = generation
+		}
+	})
+
+	t.Run("InvalidID", func(t *testing.T) {
+		rt := newTable(t)
+		for _, r := range []routetable.Route{
+			{ServiceID: "demo:1", DeviceID: deviceID, Addr: "10.0.0.1:8080"},
+			{ServiceID: "demo1", DeviceID: "DEVICE:0", Addr: "10.0.0.1:8080"},
+			{ServiceID: "", DeviceID: deviceID, Addr: "10.0.0.1:8080"},
+		} {
+			if err := rt.Register(r, time.Minute); !errors.Is(err, routetable.ErrInvalidID) {
+				t.Errorf("Register(%+v) error = %v, want ErrInvalidID", r, err)
+			}
+		}
+	})
+
+	t.Run("Watch", func(t *testing.T) {
+		rt := newTable(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events, err := rt.Watch(ctx)
+		mustNoError(t, err)
+		r := route("demo1", "10.0.0.1:8080")
+		mustNoError(t, rt.Register(r, time.Minute))
+		defer rt.Unregister(r)
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case e := <-events:
+				if e.Type == routetable.EventTypePut && e.Route == r {
+					return
+				}
+			case <-timeout:
+				t.Fatal("no put event within 5s")
+			}
+		}
+	})
+}
+
+func mustNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,62 @@
+package routetable
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/rectcircle/expose-edge-service-demo/logging"
+)
+
+// defaultPollInterval 不支持推送的后端（redis、文件）通过轮询 List 实现 Watch
+const defaultPollInterval = 2 * time.Second
+
+// pollWatch 周期性调用 list，与上一次结果做对比，生成变更事件
+func pollWatch(ctx context.Context, interval time.Duration, list func() ([]Route, error)) <-chan Event {
+	ch := make(chan Event, 16)
+	go func() {
+		defer close(ch)
+		last := map[string]Route{}
+		for {
+			routes, err := list()
+			if err != nil {
+				slog.Warn("route table watch list error", logging.Err(err))
+			} else {
+				current := make(map[string]Route, len(routes))
+				for _, r := range routes {
+					current[r.ServiceID+":"+r.DeviceID] = r
+				}
+				for k, r := range current {
+					if old, ok := last[k]; !ok || old != r {
+						if !sendEvent(ctx, ch, Event{Type: EventTypePut, Route: r}) {
+							return
+						}
+					}
+				}
+				for k, r := range last {
+					if _, ok := current[k]; !ok {
+						if !sendEvent(ctx, ch, Event{Type: EventTypeDelete, Route: r}) {
+							return
+						}
+					}
+				}
+				last = current
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+	return ch
+}
+
+func sendEvent(ctx context.Context, ch chan<- Event, e Event) bool {
+	select {
+	case ch <- e:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
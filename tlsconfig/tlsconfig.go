@@ -0,0 +1,162 @@
+// Package tlsconfig 构建设备与 exposer server 之间 websocket 链路 (wss://) 使用的 tls 配置
+package tlsconfig
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ServerConfig exposer server 的 tls 配置，CertFile 为空时不启用 tls
+type ServerConfig struct {
+	CertFile string `json:"cert_file" yaml:"cert_file" env:"EDGE_TLS_CERT_FILE" flag:"tls-cert-file" usage:"服务端证书，配置后监听 wss://"`
+	KeyFile  string `json:"key_file" yaml:"key_file" env:"EDGE_TLS_KEY_FILE" flag:"tls-key-file" usage:"服务端证书私钥"`
+	// ClientCAFile 签发设备（以及协议转换服务）客户端证书的 CA，配置后校验客户端携带的证书
+	ClientCAFile string `json:"client_ca_file" yaml:"client_ca_file" env:"EDGE_TLS_CLIENT_CA_FILE" flag:"tls-client-ca-file" usage:"校验客户端证书的 CA 文件"`
+	// PeerCAFile access 请求转发到其他 exposer server 时校验对端证书的 CA，为空时使用系统根证书
+	PeerCAFile     string `json:"peer_ca_file" yaml:"peer_ca_file" env:"EDGE_TLS_PEER_CA_FILE" flag:"tls-peer-ca-file" usage:"校验其他 exposer server 证书的 CA 文件"`
+	PeerServerName string `json:"peer_server_name" yaml:"peer_server_name" env:"EDGE_TLS_PEER_SERVER_NAME" flag:"tls-peer-server-name" usage:"校验其他 exposer server 证书时使用的域名，为空时使用对端 ip"`
+}
+
+func (c ServerConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+// Load 构建监听使用的 tls 配置。配置了 ClientCAFile 时校验客户端携带的证书，
+// 但不要求一定携带：是否必须使用证书由 Authenticator 决定。
+func (c ServerConfig) Load() (*tls.Config, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, errors.New("cert_file and key_file must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if c.ClientCAFile != "" {
+		if cfg.ClientCAs, err = loadCertPool(c.ClientCAFile); err != nil {
+			return nil, err
+		}
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg, nil
+}
+
+// LoadPeer 构建转发到其他 exposer server 时使用的 tls 配置，使用本节点的证书作为客户端证书
+func (c ServerConfig) LoadPeer() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, ServerName: c.PeerServerName, MinVersion: tls.VersionTLS12}
+	if c.PeerCAFile != "" {
+		if cfg.RootCAs, err = loadCertPool(c.PeerCAFile); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// Validate 未启用 tls 时其他配置项必须为空
+func (c ServerConfig) Validate() error {
+	if !c.Enabled() {
+		if c.KeyFile != "" || c.ClientCAFile != "" || c.PeerCAFile != "" || c.PeerServerName != "" {
+			return errors.New("cert_file must be set when other tls options are set")
+		}
+		return nil
+	}
+	if _, err := c.Load(); err != nil {
+		return err
+	}
+	_, err := c.LoadPeer()
+	return err
+}
+
+// ClientConfig 连接 exposer server (wss://) 的 tls 配置
+type ClientConfig struct {
+	// CAFile 校验 exposer server 证书的 CA，为空时使用系统根证书
+	CAFile string `json:"ca_file" yaml:"ca_file" env:"EDGE_TLS_CA_FILE" flag:"tls-ca-file" usage:"校验 exposer server 证书的 CA 文件"`
+	// CertFile、KeyFile 客户端证书，设备证书的 CommonName 或 DNS SAN 需要是设备 ID
+	CertFile string `json:"cert_file" yaml:"cert_file" env:"EDGE_TLS_CERT_FILE" flag:"tls-cert-file" usage:"客户端证书"`
+	KeyFile  string `json:"key_file" yaml:"key_file" env:"EDGE_TLS_KEY_FILE" flag:"tls-key-file" usage:"客户端证书私钥"`
+	// PinnedSHA256 证书公钥指纹（参见 Fingerprint），不为空时证书链中至少有一个证书的指纹需要在列表中
+	PinnedSHA256 []string `json:"pinned_sha256" yaml:"pinned_sha256" env:"EDGE_TLS_PINNED_SHA256" flag:"tls-pinned-sha256" usage:"固定的证书公钥 sha256 指纹 (base64)，逗号分隔"`
+	ServerName   string   `json:"server_name" yaml:"server_name" env:"EDGE_TLS_SERVER_NAME" flag:"tls-server-name" usage:"校验 exposer server 证书时使用的域名，为空时使用连接地址"`
+}
+
+// IsZero 是否没有任何 tls 配置项
+func (c ClientConfig) IsZero() bool {
+	return c.CAFile == "" && c.CertFile == "" && c.KeyFile == "" && len(c.PinnedSHA256) == 0 && c.ServerName == ""
+}
+
+func (c ClientConfig) Load() (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: c.ServerName, MinVersion: tls.VersionTLS12}
+	var err error
+	if c.CAFile != "" {
+		if cfg.RootCAs, err = loadCertPool(c.CAFile); err != nil {
+			return nil, err
+		}
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, errors.New("cert_file and key_file must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if len(c.PinnedSHA256) > 0 {
+		pins := make(map[string]bool, len(c.PinnedSHA256))
+		for _, pin := range c.PinnedSHA256 {
+			pin = strings.TrimPrefix(pin, "sha256/")
+			if b, err := base64.StdEncoding.DecodeString(pin); err != nil || len(b) != sha256.Size {
+				return nil, fmt.Errorf("bad pinned sha256 %q: want base64 encoded sha256", pin)
+			}
+			pins[pin] = true
+		}
+		// 在正常的证书链校验之后执行，CA 被攻破或误签发时依然可以拒绝
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			for _, chain := range cs.VerifiedChains {
+				for _, cert := range chain {
+					if pins[Fingerprint(cert)] {
+						return nil
+					}
+				}
+			}
+			return errors.New("tls: server certificate does not match pinned sha256")
+		}
+	}
+	return cfg, nil
+}
+
+func (c ClientConfig) Validate() error {
+	_, err := c.Load()
+	return err
+}
+
+// Fingerprint 证书公钥 (SubjectPublicKeyInfo) 的 sha256，base64 编码。等价于：
+//
+//	openssl x509 -in cert.pem -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s: no pem certificate found", path)
+	}
+	return pool, nil
+}